@@ -8,7 +8,15 @@ import (
 )
 
 type API struct {
-	Config config.Config
-	Router *mux.Router
-	Server *http.Server
+	Config  config.Config
+	Router  *mux.Router
+	Server  *http.Server
+	Closers []func() // close the modules once the server is shut down
+}
+
+// Close closes the modules, the last loaded first.
+func (api *API) Close() {
+	for i := len(api.Closers) - 1; i >= 0; i-- {
+		api.Closers[i]()
+	}
 }
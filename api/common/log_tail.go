@@ -0,0 +1,66 @@
+package common
+
+import "sync"
+
+// logTail fans the records logged out to the subscribers, e.g. the clients following the logs live. A subscriber
+// that falls behind misses records rather than holding the logging up.
+type logTail struct {
+	mu     sync.Mutex
+	subs   map[chan []byte]struct{}
+	closed bool
+}
+
+var tail = &logTail{subs: map[chan []byte]struct{}{}}
+
+// Write sends a copy of the record, which the handler writes at once, to each subscriber.
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.subs) == 0 {
+		return len(p), nil
+	}
+	rec := append([]byte(nil), p...)
+	for ch := range t.subs {
+		select {
+		case ch <- rec:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// SubscribeLog returns the channel of the records logged from now on, buffering as many as given, and the function
+// that ends the subscription. The channel is closed once the subscription ends or the tail is closed.
+func SubscribeLog(buffer int) (<-chan []byte, func()) {
+	t := tail
+	ch := make(chan []byte, buffer)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	t.subs[ch] = struct{}{}
+
+	return ch, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, ok := t.subs[ch]; ok {
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// CloseLogTail ends the subscriptions, so that the clients following the logs let the server shut down.
+func CloseLogTail() {
+	t := tail
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for ch := range t.subs {
+		delete(t.subs, ch)
+		close(ch)
+	}
+}
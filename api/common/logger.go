@@ -1,20 +1,99 @@
 package common
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
 	"github.com/nettyrnp/exch-rates/config"
 	"gopkg.in/natefinch/lumberjack.v2"
-	"path"
-	"time"
 )
 
-const (
-	logTimeFormat = `02/Jan/2006:15:04:05 -0700`
+// LevelFatal is logged by LogFatal, above the errors.
+const LevelFatal = slog.LevelError + 4
+
+// Sink opens a destination of the logs, which is written JSON records, one per line.
+type Sink func(c config.Config) (io.Writer, error)
+
+var (
+	sinksMu sync.Mutex
+	sinks   = map[string]Sink{
+		"file":   fileSink,
+		"stdout": func(config.Config) (io.Writer, error) { return os.Stdout, nil },
+		"stderr": func(config.Config) (io.Writer, error) { return os.Stderr, nil },
+		"syslog": syslogSink,
+	}
 )
 
+// RegisterSink makes the sink available by its name in LOG_SINKS.
+func RegisterSink(name string, s Sink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks[name] = s
+}
+
+// Logger is the file sink, nil if the logs are not written to a file.
 var Logger *lumberjack.Logger
 
-func InitLogger(c config.Config) {
+var (
+	level    = new(slog.LevelVar)
+	loggerMu sync.RWMutex
+	logger   = newLogger(io.MultiWriter(os.Stderr, tail))
+)
+
+// InitLogger makes the logs go to the sinks of the config, at its level. Until it is called, the logs go to stderr.
+// Either way, they are also sent to the subscribers of the tail, see SubscribeLog.
+func InitLogger(c config.Config) error {
+	if c.LogLevel != "" {
+		if err := SetLevel(c.LogLevel); err != nil {
+			return err
+		}
+	}
+
+	names := SplitList([]string{c.LogSinks})
+	if len(names) == 0 {
+		names = []string{"file"}
+	}
+	var writers []io.Writer
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for _, name := range names {
+		sink, ok := sinks[name]
+		if !ok {
+			return fmt.Errorf("unknown log sink '%s'", name)
+		}
+		w, err := sink(c)
+		if err != nil {
+			return fmt.Errorf("opening log sink '%s': %v", name, err)
+		}
+		writers = append(writers, w)
+	}
+
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = newLogger(io.MultiWriter(append(writers, tail)...))
+	return nil
+}
+
+func newLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 && a.Value.Any() == LevelFatal {
+				a.Value = slog.StringValue("FATAL")
+			}
+			return a
+		},
+	}))
+}
+
+func fileSink(c config.Config) (io.Writer, error) {
 	var fileName string
 	if c.LogDir != "" {
 		fileName = path.Join(c.LogDir, "app.log")
@@ -27,10 +106,69 @@ func InitLogger(c config.Config) {
 		MaxAge:     c.LogMaxAge, //days
 		Compress:   c.LogCompress,
 	}
+	return Logger, nil
+}
+
+func syslogSink(c config.Config) (io.Writer, error) {
+	return syslog.Dial(c.LogSyslogNetwork, c.LogSyslogAddr, syslog.LOG_INFO|syslog.LOG_DAEMON, "exchrates")
+}
+
+// SetLevel changes the least level logged, one of debug, info, warn and error, while the service runs.
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("unknown log level '%s'", name)
+	}
+	level.Set(l)
+	return nil
 }
 
-func GetLog(c config.Config) (string, error) {
-	return ReadFile(Logger.Filename)
+// Level returns the least level logged.
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+type logKey struct{}
+
+// WithLog returns a context whose logger adds the fields, given as key-value pairs, to the records,
+// e.g. WithLog(ctx, "currency", "USD").
+func WithLog(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, logKey{}, Log(ctx).With(args...))
+}
+
+// Log returns the logger of the context, which adds the fields the context was given, like the ids of the request
+// and its trace.
+func Log(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(logKey{}).(*slog.Logger); ok {
+		return l
+	}
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// LogFile returns the path of the log file, the backups being next to it, empty if the logs are not written to a file.
+func LogFile() string {
+	if Logger == nil {
+		return ""
+	}
+	return Logger.Filename
+}
+
+// RotateLogger starts a new log file, keeping the current one as a backup.
+func RotateLogger() error {
+	if Logger == nil {
+		return nil
+	}
+	return Logger.Rotate()
+}
+
+// CloseLogger closes the log file. The logger opens it again if anything is logged after.
+func CloseLogger() error {
+	if Logger == nil {
+		return nil
+	}
+	return Logger.Close()
 }
 
 func LogInfof(format string, a ...interface{}) {
@@ -46,22 +184,13 @@ func LogFatalf(format string, a ...interface{}) {
 }
 
 func LogInfo(msg string) {
-	if Logger == nil {
-		InitLogger(config.Config{})
-	}
-	Logger.Write([]byte(fmt.Sprintf("[%v] INFO: %v\n", time.Now().Format(logTimeFormat), msg)))
+	Log(context.Background()).Info(msg)
 }
 
 func LogError(msg string) {
-	if Logger == nil {
-		InitLogger(config.Config{})
-	}
-	Logger.Write([]byte(fmt.Sprintf("[%v] ERROR: %v\n", time.Now().Format(logTimeFormat), msg)))
+	Log(context.Background()).Error(msg)
 }
 
 func LogFatal(msg string) {
-	if Logger == nil {
-		InitLogger(config.Config{})
-	}
-	Logger.Write([]byte(fmt.Sprintf("[%v] FATAL: %v\n", time.Now().Format(logTimeFormat), msg)))
+	Log(context.Background()).Log(context.Background(), LevelFatal, msg)
 }
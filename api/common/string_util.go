@@ -5,6 +5,7 @@ import (
 	"github.com/pkg/errors"
 	"io/ioutil"
 	"os"
+	"strings"
 )
 
 func JoinErrors(errs []error) error {
@@ -28,3 +29,16 @@ func ReadFile(path string) (string, error) {
 	b, err := ioutil.ReadAll(file)
 	return string(b), nil
 }
+
+// SplitList flattens repeated and comma-separated values into a single list.
+func SplitList(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				res = append(res, item)
+			}
+		}
+	}
+	return res
+}
@@ -2,10 +2,33 @@ package common
 
 import (
 	"time"
+
+	"github.com/pkg/errors"
 )
 
+// timeFormat is the former zone-less format, still accepted for backward compatibility
 const timeFormat = "2006-01-02 15:04:05"
 
-func ParseTime(s string) (time.Time, error) {
-	return time.Parse(timeFormat, s)
+// ParseTime parses an RFC3339 time. A time in the former '2006-01-02 15:04:05' format has no zone,
+// so it is taken in loc.
+func ParseTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(timeFormat, s, loc); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("time '%s' is not in RFC3339 format", s)
+}
+
+// ParseLocation loads a time zone by its IANA name, e.g. 'Europe/Moscow'. An empty name stands for UTC.
+func ParseLocation(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, errors.New("time zone 'Local' is not supported")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading time zone '%s'", name)
+	}
+	return loc, nil
 }
@@ -1,14 +1,33 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/gorilla/mux"
 	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/metrics"
 	"github.com/nettyrnp/exch-rates/api/middleware"
+	"github.com/nettyrnp/exch-rates/api/tracing"
 
 	"github.com/nettyrnp/exch-rates/config"
 )
 
 func Run(c config.Config) error {
+	shutdownTracing, err := tracing.Init(tracing.Config{
+		Endpoint:    c.OtelEndpoint,
+		Insecure:    c.OtelInsecure,
+		SampleRatio: c.OtelSampleRatio,
+		ServiceName: c.OtelServiceName,
+	})
+	if err != nil {
+		return err
+	}
+
 	r := mux.NewRouter()
 
 	r.Use(
@@ -16,24 +35,84 @@ func Run(c config.Config) error {
 		mux.MiddlewareFunc(middleware.DefaultHeaders(c)),
 		//mux.MiddlewareFunc(middleware.Debugger()),
 		mux.MiddlewareFunc(middleware.RequestID()),
-		mux.MiddlewareFunc(middleware.Logger(common.Logger)),
+		mux.MiddlewareFunc(middleware.Tracing()),
+		mux.MiddlewareFunc(middleware.Logger()),
+		mux.MiddlewareFunc(middleware.Metrics()),
 	)
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
 
 	s := NewServer(r, c)
+	s.RegisterOnShutdown(common.CloseLogTail)
 	api := &API{
 		Config: c,
 		Router: r,
 		Server: s,
 	}
+	api.Closers = append(api.Closers, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			common.LogErrorf("exporting spans: %v", err)
+		}
+	})
 
 	LoadModules(api)
 
-	common.LogInfof("started HTTP server on %s\n", s.Addr)
+	serveErr := make(chan error, 1)
+	go func() {
+		common.Log(context.Background()).Info("started HTTP server", "addr", s.Addr)
+		serveErr <- s.ListenAndServe()
+	}()
 
-	if err := s.ListenAndServe(); err != nil {
-		common.LogFatalf("starting HTTP server failed with %s", err)
-		return err
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case err := <-serveErr:
+			common.LogFatalf("starting HTTP server failed with %s", err)
+			api.Close()
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err := common.RotateLogger(); err != nil {
+					common.LogErrorf("rotating logs: %v", err)
+				}
+				continue
+			}
+			common.LogInfof("shutting down on %v", sig)
+			return shutdown(api, c.ShutdownTimeout)
+		}
 	}
+}
 
-	return nil
+// shutdown stops accepting requests and drains the ones in flight, then closes the modules, which stop polling
+// and store the buffered rates, and finally closes the logs. It gives up once the timeout is over.
+func shutdown(api *API, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+	if err = api.Server.Shutdown(ctx); err != nil {
+		common.LogErrorf("draining HTTP requests: %v", err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		api.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		common.LogInfof("shut down")
+	case <-ctx.Done():
+		err = errors.New("shutdown timed out, the buffered rates may be lost")
+		common.LogError(err.Error())
+	}
+
+	if closeErr := common.CloseLogger(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
 }
@@ -0,0 +1,232 @@
+package logview
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// backupTimeFormat is the time of the rotation lumberjack puts in the names of the backups, e.g. app-2020-03-20T12-00-00.000.log
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// maxLine is the longest record read, the longer ones are skipped
+const maxLine = 1 << 20
+
+// Query selects the records of the logs. The zero query selects all of them.
+type Query struct {
+	Level     slog.Level // the least level
+	From      time.Time  // zero for unbounded
+	Till      time.Time  // zero for unbounded
+	RequestID string
+	Contains  string // case-insensitive substring of the record
+	Limit     int
+	Offset    int
+}
+
+// Page is the records selected, newest first, and the offset of the next page if there is one.
+type Page struct {
+	Records    []json.RawMessage `json:"records"`
+	NextOffset *int              `json:"next_offset,omitempty"`
+}
+
+type record struct {
+	Time      time.Time `json:"time"`
+	Level     string    `json:"level"`
+	RequestID string    `json:"request_id"`
+}
+
+// ParseLevel parses one of debug, info, warn, error and fatal, regardless of the case.
+func ParseLevel(s string) (slog.Level, error) {
+	if strings.EqualFold(s, "fatal") {
+		return slog.LevelError + 4, nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, errors.Errorf("unknown log level '%s'", s)
+	}
+	return l, nil
+}
+
+// Match tells whether the record, a line of JSON, is selected. The lines that are not JSON records are not.
+func (q Query) Match(line []byte) bool {
+	var rec record
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return false
+	}
+	if lvl, err := ParseLevel(rec.Level); err != nil || lvl < q.Level {
+		return false
+	}
+	if !q.From.IsZero() && rec.Time.Before(q.From) {
+		return false
+	}
+	if !q.Till.IsZero() && rec.Time.After(q.Till) {
+		return false
+	}
+	if q.RequestID != "" && rec.RequestID != q.RequestID {
+		return false
+	}
+	if q.Contains != "" && !bytes.Contains(bytes.ToLower(line), []byte(strings.ToLower(q.Contains))) {
+		return false
+	}
+	return true
+}
+
+// Search returns a page of the records of the log file and its backups, rotated and compressed by lumberjack,
+// that the query selects.
+func Search(file string, q Query) (*Page, error) {
+	files, err := logFiles(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// one more than the page tells whether there is a next one
+	want := q.Offset + q.Limit + 1
+	var found [][]byte
+	for _, f := range files {
+		if !q.From.IsZero() && !f.rotated.IsZero() && f.rotated.Before(q.From) {
+			break // the backup and the older ones are all before the range
+		}
+		matches, err := searchFile(f.path, q, want-len(found))
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, matches...)
+		if len(found) >= want {
+			break
+		}
+	}
+
+	page := &Page{Records: []json.RawMessage{}}
+	for i := q.Offset; i < len(found) && i < q.Offset+q.Limit; i++ {
+		page.Records = append(page.Records, found[i])
+	}
+	if len(found) > q.Offset+q.Limit {
+		next := q.Offset + q.Limit
+		page.NextOffset = &next
+	}
+	return page, nil
+}
+
+type logFile struct {
+	path    string
+	rotated time.Time // zero for the current file
+}
+
+// logFiles returns the log file followed by its backups, newest first.
+func logFiles(file string) ([]logFile, error) {
+	dir, base := filepath.Split(file)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing log files")
+	}
+
+	var files []logFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+		rotated, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		files = append(files, logFile{path: filepath.Join(dir, name), rotated: rotated})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].rotated.After(files[j].rotated) })
+
+	if _, err := os.Stat(file); err == nil {
+		files = append([]logFile{{path: file}}, files...)
+	}
+	return files, nil
+}
+
+// searchFile returns the newest n records of the file that the query selects, newest first.
+func searchFile(path string, q Query, n int) ([][]byte, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil // rotated away meanwhile
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "opening log file")
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decompressing %s", filepath.Base(path))
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	// the last n matches are kept in a ring, the file being read oldest first
+	var ring [][]byte
+	count := 0
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := readLine(reader)
+		if len(line) > 0 && q.Match(line) {
+			if len(ring) < n {
+				ring = append(ring, line)
+			} else {
+				ring[count%n] = line
+			}
+			count++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", filepath.Base(path))
+		}
+	}
+
+	kept := count
+	if kept > n {
+		kept = n
+	}
+	res := make([][]byte, 0, kept)
+	for i := 1; i <= kept; i++ {
+		res = append(res, ring[(count-i)%n])
+	}
+	return res, nil
+}
+
+// readLine returns the next line without its newline, or nil if the line is too long.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > maxLine {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if tooLong {
+			return nil, err
+		}
+		return bytes.TrimRight(line, "\r\n"), err
+	}
+}
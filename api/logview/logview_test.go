@@ -0,0 +1,90 @@
+package logview
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2020, 3, 20, 12, 0, 0, 0, time.UTC)
+
+// writeLog writes a record a minute from the minute of start given, the even ones of the request 'even'
+func writeLog(t *testing.T, path string, from, till int) {
+	var lines []string
+	for i := from; i < till; i++ {
+		level, rid := "INFO", "odd"
+		if i%5 == 0 {
+			level = "ERROR"
+		}
+		if i%2 == 0 {
+			rid = "even"
+		}
+		lines = append(lines, fmt.Sprintf(`{"time":"%s","level":"%s","msg":"record %d","request_id":"%s"}`,
+			start.Add(time.Duration(i)*time.Minute).Format(time.RFC3339Nano), level, i, rid))
+	}
+	lines = append(lines, "not a record")
+	data := []byte(strings.Join(lines, "\n") + "\n")
+
+	if !strings.HasSuffix(path, ".gz") {
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		return
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+}
+
+func messages(t *testing.T, page *Page) []string {
+	var res []string
+	for _, rec := range page.Records {
+		var r struct{ Msg string }
+		require.NoError(t, json.Unmarshal(rec, &r))
+		res = append(res, r.Msg)
+	}
+	return res
+}
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.log")
+	writeLog(t, filepath.Join(dir, "app-2020-03-20T12-10-00.000.log.gz"), 0, 10)
+	writeLog(t, filepath.Join(dir, "app-2020-03-20T12-20-00.000.log"), 10, 20)
+	writeLog(t, file, 20, 30)
+
+	page, err := Search(file, Query{Limit: 4})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"record 29", "record 28", "record 27", "record 26"}, messages(t, page))
+	require.NotNil(t, page.NextOffset)
+
+	page, err = Search(file, Query{Level: slog.LevelError, Limit: 4, Offset: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"record 15", "record 10", "record 5", "record 0"}, messages(t, page), "the pages go on into the backups")
+	assert.Nil(t, page.NextOffset)
+
+	page, err = Search(file, Query{RequestID: "even", Contains: "RECORD 1", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"record 18", "record 16", "record 14", "record 12", "record 10"}, messages(t, page))
+
+	page, err = Search(file, Query{From: start.Add(8 * time.Minute), Till: start.Add(11 * time.Minute), Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"record 11", "record 10", "record 9", "record 8"}, messages(t, page))
+
+	page, err = Search(file, Query{Contains: "not a record", Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Records, "the lines that are not records are skipped")
+}
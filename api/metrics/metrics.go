@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	Registry = prometheus.NewRegistry()
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "exchrates_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "exchrates_http_request_duration_seconds",
+		Help:    "Latency of the HTTP requests by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	Polls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "exchrates_polls_total",
+		Help: "Polls of the rates by currency and result (success, failure).",
+	}, []string{"currency", "result"})
+
+	PollDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "exchrates_poll_duration_seconds",
+		Help:    "Latency of the polls of the rates by currency.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"currency"})
+
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "exchrates_repository_query_duration_seconds",
+		Help:    "Duration of the repository queries, transaction included, by query.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"query"})
+
+	Latest = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "exchrate_latest",
+		Help: "The latest rate polled by base and quote currency.",
+	}, []string{"base", "quote"})
+
+	lastRates = &sinceCollector{
+		desc: prometheus.NewDesc("exchrates_poller_seconds_since_last_rate",
+			"Seconds since the poller last got a rate of the currency.", []string{"currency"}, nil),
+		times: map[string]time.Time{},
+	}
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPDuration, Polls, PollDuration, QueryDuration, Latest, lastRates,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB exposes the connection pool stats of the db. A db of a name already exposed is ignored.
+func RegisterDB(name string, db *sql.DB) {
+	if err := Registry.Register(collectors.NewDBStatsCollector(db, name)); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			panic(err)
+		}
+	}
+}
+
+// ObservePoll records a poll of the currency that took since start.
+func ObservePoll(currency string, start time.Time, err error) {
+	PollDuration.WithLabelValues(currency).Observe(time.Since(start).Seconds())
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	Polls.WithLabelValues(currency, result).Inc()
+}
+
+// ObserveRate records a rate got by the poller.
+func ObserveRate(base, quote string, rate decimal.Decimal, at time.Time) {
+	f, _ := rate.Float64()
+	Latest.WithLabelValues(base, quote).Set(f)
+	lastRates.mark(base, at)
+}
+
+// sinceCollector exposes how long ago each currency was last seen, as of the scrape
+type sinceCollector struct {
+	desc  *prometheus.Desc
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+func (c *sinceCollector) mark(currency string, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.times[currency] = at
+}
+
+func (c *sinceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *sinceCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for currency, at := range c.times {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, time.Since(at).Seconds(), currency)
+	}
+}
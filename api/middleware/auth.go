@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/sys/dto"
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// KeyAuthenticator resolves an API key into the client it belongs to. It returns nil for an unknown or revoked key.
+type KeyAuthenticator interface {
+	AuthenticateKey(ctx context.Context, key string) (*entity.Principal, error)
+}
+
+type AuthConfig struct {
+	Enabled   bool
+	JWTSecret []byte // JWTs are not accepted if empty
+}
+
+type principalKey struct{}
+
+// anonymous makes the requests when the authentication is disabled
+var anonymous = &entity.Principal{Name: "anonymous", Role: entity.RoleAdmin}
+
+// Authenticate resolves the client of the request from an API key in the X-API-Key header, or from an API key or
+// a JWT as the bearer token of the Authorization header. A request with no credentials passes on anonymous, to be
+// turned down by Require, while a request with invalid ones is turned down right away.
+func Authenticate(keys KeyAuthenticator, cfg AuthConfig) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !cfg.Enabled {
+				h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, anonymous)))
+				return
+			}
+
+			token := tokenOf(r)
+			if token == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			var p *entity.Principal
+			var err error
+			if strings.Count(token, ".") == 2 && len(cfg.JWTSecret) > 0 {
+				p, err = ParseJWT(token, cfg.JWTSecret)
+			} else {
+				p, err = keys.AuthenticateKey(r.Context(), token)
+			}
+			if err != nil {
+				common.Log(r.Context()).Error("authenticating request", "path", r.URL.Path, "error", err)
+			}
+			if p == nil {
+				deny(w, http.StatusUnauthorized, "invalid credentials")
+				return
+			}
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+		})
+	}
+}
+
+// tokenOf returns the API key or the JWT the request carries, empty if it carries none
+func tokenOf(r *http.Request) string {
+	token := r.Header.Get("X-API-Key")
+	if bearer := r.Header.Get("Authorization"); token == "" && strings.HasPrefix(bearer, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(bearer, "Bearer "))
+	}
+	return token
+}
+
+// Require lets only the clients of the role, or of a role allowed more, through to the handler.
+func Require(role string) func(h http.HandlerFunc) http.HandlerFunc {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			p := PrincipalFrom(r.Context())
+			if p == nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="exchrates"`)
+				deny(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			if !entity.RoleAllows(p.Role, role) {
+				deny(w, http.StatusForbidden, "the "+role+" role is required")
+				return
+			}
+			h(w, r)
+		}
+	}
+}
+
+// PrincipalFrom returns the client the request of the context is made by, nil if the request is anonymous.
+func PrincipalFrom(ctx context.Context) *entity.Principal {
+	p, _ := ctx.Value(principalKey{}).(*entity.Principal)
+	return p
+}
+
+func deny(w http.ResponseWriter, statusCode int, msg string) {
+	response := dto.NewServiceResponse()
+	response.Status.Code = statusCode
+	response.Status.Text = msg
+	jsonResponse, _ := json.Marshal(response)
+	w.WriteHeader(statusCode)
+	w.Write(jsonResponse)
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+type fakeKeys map[string]*entity.Principal
+
+func (k fakeKeys) AuthenticateKey(ctx context.Context, key string) (*entity.Principal, error) {
+	return k[key], nil
+}
+
+func signJWT(payload string, secret []byte) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	keys := fakeKeys{"xr_reader": {Name: "dashboard", Role: entity.RoleReader}}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := Authenticate(keys, AuthConfig{Enabled: true, JWTSecret: secret})(Require(entity.RoleOperator)(ok))
+	exp := time.Now().Add(time.Hour).Unix()
+
+	for name, tc := range map[string]struct {
+		header, value string
+		status        int
+	}{
+		"no credentials":      {"", "", http.StatusUnauthorized},
+		"unknown key":         {"X-API-Key", "xr_unknown", http.StatusUnauthorized},
+		"role too low":        {"X-API-Key", "xr_reader", http.StatusForbidden},
+		"operator JWT":        {"Authorization", "Bearer " + signJWT(`{"sub":"ops","role":"operator","exp":`+strconv.FormatInt(exp, 10)+`}`, secret), http.StatusOK},
+		"JWT of another key":  {"Authorization", "Bearer " + signJWT(`{"sub":"ops","role":"admin","exp":`+strconv.FormatInt(exp, 10)+`}`, []byte("other")), http.StatusUnauthorized},
+		"JWT without expiry":  {"Authorization", "Bearer " + signJWT(`{"sub":"ops","role":"admin"}`, secret), http.StatusUnauthorized},
+		"JWT of unknown role": {"Authorization", "Bearer " + signJWT(`{"sub":"ops","role":"root","exp":`+strconv.FormatInt(exp, 10)+`}`, secret), http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/exchrates/start_poll", nil)
+		if tc.header != "" {
+			r.Header.Set(tc.header, tc.value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, tc.status, w.Code, name)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		h := Authenticate(keys, AuthConfig{})(Require(entity.RoleAdmin)(ok))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/exchrates/admin/import", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
@@ -1,8 +1,6 @@
 package middleware
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"github.com/nettyrnp/exch-rates/api/common"
 	"net/http"
@@ -18,7 +16,7 @@ func Debugger() Middleware {
 				http.Error(w, fmt.Sprint(err), http.StatusInternalServerError)
 				return
 			}
-			common.LogInfo("\n\n" + string(x) + "\n")
+			common.Log(r.Context()).Debug("request dump", "dump", string(x))
 			rec := httptest.NewRecorder()
 			h.ServeHTTP(rec, r)
 			dump, err := httputil.DumpResponse(rec.Result(), false)
@@ -26,7 +24,7 @@ func Debugger() Middleware {
 				http.Error(w, fmt.Sprint(err), http.StatusInternalServerError)
 				return
 			}
-			common.LogInfo("\n" + string(dump))
+			common.Log(r.Context()).Debug("response dump", "dump", string(dump))
 			// we copy the captured response headers to our new response
 			for k, v := range rec.Header() {
 				w.Header()[k] = v
@@ -34,17 +32,8 @@ func Debugger() Middleware {
 
 			// grab the captured response body
 			data := rec.Body.Bytes()
-			common.LogInfo(jsonPrettyPrint(string(data)))
+			common.Log(r.Context()).Debug("response body", "body", string(data))
 			w.Write(data)
 		})
 	}
 }
-
-func jsonPrettyPrint(in string) string {
-	var out bytes.Buffer
-	err := json.Indent(&out, []byte(in), "", "  ")
-	if err != nil {
-		return in
-	}
-	return out.String()
-}
@@ -11,7 +11,8 @@ func DefaultHeaders(conf config.Config) Middleware {
 
 			w.Header().Set("Access-Control-Allow-Methods", "GET,HEAD,POST,OPTIONS")
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, If-None-Match, If-Modified-Since, X-Request-ID, traceparent, tracestate")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-Quota-Limit, X-Quota-Remaining, X-Request-ID, X-Trace-ID")
 			if r.Method == http.MethodOptions {
 				return
 			}
@@ -1,14 +1,35 @@
 package middleware
 
 import (
-	"io"
+	"log/slog"
 	"net/http"
+	"time"
 
-	"github.com/gorilla/handlers"
+	"github.com/nettyrnp/exch-rates/api/common"
 )
 
-func Logger(out io.Writer) Middleware {
+// Logger logs each request once it is served, along with the fields of its context, like its id and trace.
+// The server errors are logged as errors.
+func Logger() Middleware {
 	return func(h http.Handler) http.Handler {
-		return handlers.CombinedLoggingHandler(out, h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			h.ServeHTTP(rec, r)
+
+			lvl := slog.LevelInfo
+			if rec.status >= http.StatusInternalServerError {
+				lvl = slog.LevelError
+			}
+			common.Log(r.Context()).Log(r.Context(), lvl, "request",
+				"method", r.Method,
+				"path", r.URL.RequestURI(),
+				"status", rec.status,
+				"bytes", rec.bytes,
+				"duration_ms", time.Since(start).Milliseconds(),
+				"remote", r.RemoteAddr,
+				"user_agent", r.UserAgent(),
+			)
+		})
 	}
 }
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nettyrnp/exch-rates/api/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	r := mux.NewRouter()
+	r.Use(mux.MiddlewareFunc(Metrics()))
+	r.HandleFunc("/exchrates/fixings/{date}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+
+	for _, date := range []string{"2020-03-20", "2020-03-21"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/exchrates/fixings/"+date, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("/exchrates/fixings/{date}", "GET", "404")))
+}
@@ -0,0 +1,333 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// UsageStore keeps the daily usage of the clients.
+type UsageStore interface {
+	AddUsage(ctx context.Context, usage []entity.Usage) error
+	GetUsage(ctx context.Context, date string) ([]entity.Usage, error)
+}
+
+type RateLimitConfig struct {
+	Rate         float64 // the cost a client may spend per second, 0 for no rate limit
+	Burst        int     // the cost a client may spend at once
+	Quota        int64   // the cost a client may spend per day (UTC), 0 for no quota
+	TrustProxy   bool    // the clients known by their IP are taken from X-Forwarded-For
+	FlushEvery   time.Duration
+	FlushTimeout time.Duration
+}
+
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+type usageKey struct {
+	date, client string
+}
+
+// Limiter keeps a token bucket and the usage of the day per client. The buckets are kept by the instance,
+// while the usage is flushed to the store and read back when the limiter starts, so that the quota holds
+// across restarts.
+type Limiter struct {
+	Cfg   RateLimitConfig
+	Store UsageStore
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	day     string
+	spent   map[string]int64           // the cost spent on day per client
+	pending map[usageKey]*entity.Usage // the usage not flushed yet
+	now     func() time.Time
+
+	runMu   sync.Mutex // serializes Start and Stop
+	started bool
+	done    chan struct{}
+}
+
+func NewLimiter(cfg RateLimitConfig, store UsageStore) *Limiter {
+	return &Limiter{
+		Cfg:     cfg,
+		Store:   store,
+		buckets: map[string]*tokenBucket{},
+		spent:   map[string]int64{},
+		pending: map[usageKey]*entity.Usage{},
+		now:     time.Now,
+	}
+}
+
+// Start reads the usage of the day and starts flushing the usage periodically.
+func (l *Limiter) Start() {
+	l.runMu.Lock()
+	defer l.runMu.Unlock()
+	if l.Store == nil || l.started {
+		return
+	}
+	l.started = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.Cfg.FlushTimeout)
+	day := l.now().UTC().Format(entity.DateFormat)
+	usage, err := l.Store.GetUsage(ctx, day)
+	cancel()
+	if err != nil {
+		common.LogErrorf("Reading the API usage of %s: %v", day, err)
+	}
+	l.mu.Lock()
+	l.rollDay(day)
+	for _, u := range usage {
+		l.spent[u.Client] += u.Cost
+	}
+	l.mu.Unlock()
+
+	if l.Cfg.FlushEvery <= 0 {
+		return
+	}
+	l.done = make(chan struct{})
+	go l.run(l.done)
+}
+
+// Stop flushes whatever usage is left.
+func (l *Limiter) Stop() {
+	l.runMu.Lock()
+	defer l.runMu.Unlock()
+	if l.done != nil {
+		close(l.done)
+		l.done = nil
+	}
+	l.started = false
+	if err := l.Flush(); err != nil {
+		common.LogError(err.Error())
+	}
+}
+
+func (l *Limiter) run(done chan struct{}) {
+	ticker := time.NewTicker(l.Cfg.FlushEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if err := l.Flush(); err != nil {
+			common.LogError(err.Error())
+		}
+	}
+}
+
+// Flush stores the usage recorded since the previous flush, and forgets the buckets that are full again.
+// If the store fails, the usage is kept for the next flush.
+func (l *Limiter) Flush() error {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = map[usageKey]*entity.Usage{}
+	now := l.now()
+	for client, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.Cfg.Burst) {
+			delete(l.buckets, client)
+		}
+	}
+	l.mu.Unlock()
+
+	if len(pending) == 0 || l.Store == nil {
+		return nil
+	}
+	usage := make([]entity.Usage, 0, len(pending))
+	for _, u := range pending {
+		usage = append(usage, *u)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.Cfg.FlushTimeout)
+	defer cancel()
+	if err := l.Store.AddUsage(ctx, usage); err != nil {
+		l.mu.Lock()
+		for k, u := range pending {
+			l.record(k, u.Requests, u.Cost, u.Rejected)
+		}
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// decision is the outcome of a request of a client: whether it may go on and the state of the limits after it
+type decision struct {
+	allowed    bool
+	remaining  float64
+	reset      time.Duration // till the bucket is full again
+	retryAfter time.Duration // till the request could go on, if it may not
+	quotaLeft  int64
+}
+
+// take spends the cost from the bucket and the quota of the client if both have enough left
+func (l *Limiter) take(client string, cost int) decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	day := now.UTC().Format(entity.DateFormat)
+	l.rollDay(day)
+	k := usageKey{day, client}
+
+	d := decision{allowed: true, quotaLeft: -1}
+	if l.Cfg.Quota > 0 {
+		d.quotaLeft = l.Cfg.Quota - l.spent[client]
+		if d.quotaLeft < int64(cost) {
+			midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			d.allowed, d.retryAfter = false, midnight.Sub(now)
+		}
+	}
+
+	if l.Cfg.Rate > 0 && d.allowed {
+		b := l.bucketOf(client, now)
+		d.allowed, d.retryAfter = l.spend(b, float64(cost))
+		d.remaining = b.tokens
+		d.reset = time.Duration((float64(l.Cfg.Burst) - b.tokens) / l.Cfg.Rate * float64(time.Second))
+	}
+
+	if !d.allowed {
+		l.record(k, 1, 0, 1)
+		return d
+	}
+	l.spent[client] += int64(cost)
+	if d.quotaLeft >= 0 {
+		d.quotaLeft -= int64(cost)
+	}
+	l.record(k, 1, int64(cost), 0)
+	return d
+}
+
+// throttle spends a token from the bucket of the key, telling how long till it could if there is none left.
+// Unlike take, it charges neither the quota nor the usage.
+func (l *Limiter) throttle(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.spend(l.bucketOf(key, l.now()), 1)
+}
+
+func (l *Limiter) bucketOf(key string, now time.Time) *tokenBucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.Cfg.Burst), at: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	return b
+}
+
+// spend takes the cost, at most the burst, from the refilled bucket if it has enough, or else tells how long
+// till it would
+func (l *Limiter) spend(b *tokenBucket, cost float64) (bool, time.Duration) {
+	cost = math.Min(cost, float64(l.Cfg.Burst))
+	if b.tokens < cost {
+		return false, time.Duration((cost - b.tokens) / l.Cfg.Rate * float64(time.Second))
+	}
+	b.tokens -= cost
+	return true, 0
+}
+
+// refill returns the tokens of the bucket as of now, recording them in the bucket
+func (l *Limiter) refill(b *tokenBucket, now time.Time) float64 {
+	b.tokens = math.Min(float64(l.Cfg.Burst), b.tokens+now.Sub(b.at).Seconds()*l.Cfg.Rate)
+	b.at = now
+	return b.tokens
+}
+
+func (l *Limiter) record(k usageKey, requests, cost, rejected int64) {
+	u, ok := l.pending[k]
+	if !ok {
+		u = &entity.Usage{Date: k.date, Client: k.client}
+		l.pending[k] = u
+	}
+	u.Requests += requests
+	u.Cost += cost
+	u.Rejected += rejected
+}
+
+// rollDay starts counting the quotas anew once the day is over
+func (l *Limiter) rollDay(day string) {
+	if l.day != day {
+		l.day = day
+		l.spent = map[string]int64{}
+	}
+}
+
+// clientOf returns who the request is counted against: the authenticated client, or else the IP of the request
+func (l *Limiter) clientOf(r *http.Request) string {
+	if p := PrincipalFrom(r.Context()); p != nil && p != anonymous {
+		if p.KeyID != 0 {
+			return "key:" + p.Name
+		}
+		return "jwt:" + p.Name
+	}
+	return "ip:" + l.ipOf(r)
+}
+
+func (l *Limiter) ipOf(r *http.Request) string {
+	if l.Cfg.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host
+}
+
+// LimitAuth turns down with 429 the requests carrying credentials once their IP is over the rate limit, before the
+// credentials are looked up, so that trying out keys cannot flood the db. Each IP is charged a token per request
+// from a bucket of its own, apart from the buckets of the clients charged by RateLimit.
+func LimitAuth(l *Limiter) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if l.Cfg.Rate > 0 && tokenOf(r) != "" {
+				if ok, retryAfter := l.throttle("auth:" + l.ipOf(r)); !ok {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+					deny(w, http.StatusTooManyRequests, "too many requests")
+					return
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit charges the requests to the handlers the cost of each one, turning them down with 429
+// once the client is over its rate limit or its daily quota.
+func RateLimit(l *Limiter) func(cost int, h http.HandlerFunc) http.HandlerFunc {
+	return func(cost int, h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			d := l.take(l.clientOf(r), cost)
+			if l.Cfg.Rate > 0 {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.Cfg.Burst))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(d.remaining)))
+				w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(d.reset.Seconds()))))
+			}
+			if d.quotaLeft >= 0 {
+				w.Header().Set("X-Quota-Limit", strconv.FormatInt(l.Cfg.Quota, 10))
+				w.Header().Set("X-Quota-Remaining", strconv.FormatInt(d.quotaLeft, 10))
+			}
+			if !d.allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.retryAfter.Seconds()))))
+				deny(w, http.StatusTooManyRequests, "too many requests")
+				return
+			}
+			h(w, r)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 3, 20, 23, 59, 0, 0, time.UTC)
+	l := NewLimiter(RateLimitConfig{Rate: 1, Burst: 10, Quota: 25}, nil)
+	l.now = func() time.Time { return now }
+	h := RateLimit(l)(4, func(w http.ResponseWriter, r *http.Request) {})
+
+	serve := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/exchrates/history", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1:5000").Code)
+	w := serve("10.0.0.1:5001")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "8", w.Header().Get("X-RateLimit-Reset"))
+	assert.Equal(t, "17", w.Header().Get("X-Quota-Remaining"))
+
+	w = serve("10.0.0.1:5002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, serve("10.0.0.2:5000").Code, "the other clients have buckets of their own")
+
+	for i := 0; i < 4; i++ {
+		now = now.Add(4 * time.Second)
+		assert.Equal(t, http.StatusOK, serve("10.0.0.1:5000").Code)
+	}
+	now = now.Add(4 * time.Second)
+	w = serve("10.0.0.1:5000")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "the quota is spent")
+	assert.Equal(t, "1", w.Header().Get("X-Quota-Remaining"))
+	assert.Equal(t, "40", w.Header().Get("Retry-After"), "till midnight")
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1:5000").Code, "the quota is renewed the next day")
+
+	u := l.pending[usageKey{"2020-03-20", "ip:10.0.0.1"}]
+	assert.Equal(t, int64(8), u.Requests)
+	assert.Equal(t, int64(24), u.Cost)
+	assert.Equal(t, int64(2), u.Rejected)
+}
+
+func TestLimitAuth(t *testing.T) {
+	t.Parallel()
+
+	keys := fakeKeys{}
+	l := NewLimiter(RateLimitConfig{Rate: 1, Burst: 2}, nil)
+	now := time.Date(2020, 3, 20, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	h := LimitAuth(l)(Authenticate(keys, AuthConfig{Enabled: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	serve := func(key string) int {
+		req := httptest.NewRequest("GET", "/exchrates/history", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve("xr_1"))
+	assert.Equal(t, http.StatusUnauthorized, serve("xr_2"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("xr_3"), "the keys are not looked up once the IP is over the limit")
+	assert.Equal(t, http.StatusOK, serve(""), "the requests without credentials are left to RateLimit")
+
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusUnauthorized, serve("xr_4"))
+}
@@ -1,18 +1,18 @@
 package middleware
 
 import (
-	"context"
 	"net/http"
 
 	uuid "github.com/satori/go.uuid"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/tracing"
 )
 
-// RequestID generates an unique identifier
+// RequestID takes the id of the request from the X-Request-ID header, or generates an unique one, and returns
+// it in the X-Request-ID header of the response. The id is kept in the context, see tracing.RequestID, and
+// added to what is logged of the request.
 func RequestID() Middleware {
-
-	type ctxKey int
-	const ridKey = ctxKey(0)
-
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			rid := r.Header.Get("X-Request-ID")
@@ -20,7 +20,8 @@ func RequestID() Middleware {
 				rid = uuid.NewV4().String()
 				r.Header.Set("X-Request-ID", rid)
 			}
-			ctx := context.WithValue(r.Context(), ridKey, rid)
+			w.Header().Set("X-Request-ID", rid)
+			ctx := common.WithLog(tracing.WithRequestID(r.Context(), rid), "request_id", rid)
 			h.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
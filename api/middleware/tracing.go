@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/tracing"
+)
+
+// Tracing continues the trace of the traceparent header of the request, or starts one, with a span of the request
+// named by its route, and returns the id of the trace in the X-Trace-ID header of the response. The id is
+// added to what is logged of the request.
+func Tracing() Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if tpl, err := current.GetPathTemplate(); err == nil {
+					route = tpl
+				}
+			}
+			ctx, span := tracing.Start(ctx, r.Method+" "+route,
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPRoute(route),
+				attribute.String("http.request_id", tracing.RequestID(ctx)),
+			)
+			defer span.End()
+
+			if tid := tracing.TraceID(ctx); tid != "" {
+				w.Header().Set("X-Trace-ID", tid)
+				ctx = common.WithLog(ctx, "trace_id", tid)
+			}
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			h.ServeHTTP(rec, r.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPStatusCode(rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, strconv.Itoa(rec.status))
+			}
+		})
+	}
+}
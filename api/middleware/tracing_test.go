@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/tracing"
+	"github.com/nettyrnp/exch-rates/config"
+)
+
+func TestTracing(t *testing.T) {
+	_, err := tracing.Init(tracing.Config{SampleRatio: 1, ServiceName: "test"})
+	require.NoError(t, err)
+	var logs bytes.Buffer
+	common.RegisterSink("test", func(config.Config) (io.Writer, error) { return &logs, nil })
+	require.NoError(t, common.InitLogger(config.Config{LogSinks: "test", LogLevel: "info"}))
+	defer common.InitLogger(config.Config{LogSinks: "stderr"})
+
+	r := mux.NewRouter()
+	r.Use(mux.MiddlewareFunc(RequestID()), mux.MiddlewareFunc(Tracing()), mux.MiddlewareFunc(Logger()))
+	r.HandleFunc("/exchrates/fixings/{date}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/exchrates/fixings/2020-03-20", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, "req-1", rec.Header().Get("X-Request-ID"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", rec.Header().Get("X-Trace-ID"), "the trace of the caller is continued")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "request", record["msg"])
+	assert.Equal(t, "req-1", record["request_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", record["trace_id"])
+	assert.Equal(t, "/exchrates/fixings/2020-03-20", record["path"])
+	assert.Equal(t, 200.0, record["status"])
+	assert.Equal(t, 2.0, record["bytes"])
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/exchrates/fixings/2020-03-20", nil))
+	assert.NotEmpty(t, rec.Header().Get("X-Request-ID"))
+	assert.Len(t, rec.Header().Get("X-Trace-ID"), 32, "a trace is started if there is none")
+
+	logs.Reset()
+	require.NoError(t, common.SetLevel("warn"))
+	defer common.SetLevel("info")
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/exchrates/fixings/2020-03-20", nil))
+	assert.Empty(t, logs.String(), "the requests are not logged above info")
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"github.com/gorilla/mux"
+	"github.com/nettyrnp/exch-rates/api/middleware"
 	"github.com/nettyrnp/exch-rates/api/sys"
 	"github.com/nettyrnp/exch-rates/api/sys/entity"
 	"github.com/nettyrnp/exch-rates/config"
@@ -12,6 +14,11 @@ func LoadModules(api *API) {
 }
 
 func (api *API) NewExchratesModule(conf config.Config) {
-	c := sys.NewController(conf, string(entity.KindExchratesService))
-	sys.Route(api.Router, c)
+	m := sys.NewModule(conf, string(entity.KindExchratesService))
+	api.Router.Use(
+		mux.MiddlewareFunc(middleware.LimitAuth(m.Limiter)),
+		mux.MiddlewareFunc(sys.Authenticator(m.Controller)),
+	)
+	sys.Route(api.Router, m.Controller, m.Limiter)
+	api.Closers = append(api.Closers, m.Close)
 }
@@ -0,0 +1,141 @@
+package anomaly
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+type Store interface {
+	GetRecentExchrates(ctx context.Context, currency, quote, source string, before time.Time, n int) ([]entity.Exchrate, error)
+	QuarantineExchrate(ctx context.Context, q entity.Quarantined) (int64, error)
+}
+
+type Config struct {
+	Threshold    float64 // how many deviations a return may be off the mean, 0 to not check the rates
+	Alpha        float64 // the weight of the latest return in the moving mean and variance
+	Warmup       int     // how many returns of a pair are seen before its rates are checked
+	MinDeviation float64 // the floor of the deviation, so that a pair whose rate barely moves is not judged by noise
+	Patience     int     // after this many rates of a pair in a row are quarantined, the pair is taken to have moved there
+}
+
+// model is an exponentially weighted moving mean and variance of the returns of a pair
+type model struct {
+	last     decimal.Decimal
+	mean     float64
+	variance float64
+	returns  int
+	rejected int
+}
+
+// score returns how many deviations the return of the rate is off the mean of the model, and the return itself
+func (m *model) score(rate decimal.Decimal, minDeviation float64) (float64, float64) {
+	if m.last.IsZero() {
+		return 0, 0
+	}
+	r, _ := rate.Div(m.last).Sub(decimal.NewFromInt(1)).Float64()
+	deviation := math.Max(math.Sqrt(m.variance), minDeviation)
+	return math.Abs(r-m.mean) / deviation, r
+}
+
+func (m *model) accept(rate decimal.Decimal, alpha float64) {
+	if !m.last.IsZero() {
+		r, _ := rate.Div(m.last).Sub(decimal.NewFromInt(1)).Float64()
+		if m.returns == 0 {
+			m.mean = r
+		} else {
+			d := r - m.mean
+			m.mean += alpha * d
+			m.variance = (1 - alpha) * (m.variance + alpha*d*d)
+		}
+		m.returns++
+	}
+	m.last = rate
+	m.rejected = 0
+}
+
+type pairKey struct {
+	currency, quote, source string
+}
+
+// Guard checks the polled rates against the recent returns of their pairs and quarantines the suspicious ones.
+// The model of a pair is seeded from its stored rates when the pair is first seen.
+type Guard struct {
+	Cfg   Config
+	Store Store
+
+	mu     sync.Mutex
+	models map[pairKey]*model
+}
+
+func New(cfg Config, store Store) *Guard {
+	return &Guard{
+		Cfg:    cfg,
+		Store:  store,
+		models: map[pairKey]*model{},
+	}
+}
+
+// Admit tells whether the rate may be stored. A rate that may not is quarantined, which also emits an event.
+// The rates are expected in the order of time per pair. If the rate cannot be checked, it is admitted along
+// with the error, so that a failure of the check does not stop the polling.
+func (g *Guard) Admit(ctx context.Context, e entity.Exchrate) (bool, error) {
+	if g.Cfg.Threshold <= 0 {
+		return true, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	m, err := g.model(ctx, e)
+	if err != nil {
+		return true, err
+	}
+	score, _ := m.score(e.Rate, g.Cfg.MinDeviation)
+	if m.returns < g.Cfg.Warmup || score <= g.Cfg.Threshold || (g.Cfg.Patience > 0 && m.rejected >= g.Cfg.Patience) {
+		m.accept(e.Rate, g.Cfg.Alpha)
+		return true, nil
+	}
+
+	q := entity.Quarantined{
+		Time:     e.Time,
+		Currency: e.Currency,
+		Quote:    e.Quote,
+		Source:   e.Source,
+		Rate:     e.Rate,
+		Expected: m.last,
+		Score:    score,
+	}
+	if _, err := g.Store.QuarantineExchrate(ctx, q); err != nil {
+		return true, errors.Wrapf(err, "quarantining %s/%s rate at %v", e.Currency, e.Quote, e.Time)
+	}
+	m.rejected++
+	common.Log(ctx).Warn("quarantined rate",
+		"quote", e.Quote, "time", e.Time, "rate", e.Rate, "expected", m.last, "deviations", score)
+	return false, nil
+}
+
+func (g *Guard) model(ctx context.Context, e entity.Exchrate) (*model, error) {
+	k := pairKey{e.Currency, e.Quote, e.Source}
+	if m, ok := g.models[k]; ok {
+		return m, nil
+	}
+
+	recent, err := g.Store.GetRecentExchrates(ctx, e.Currency, e.Quote, e.Source, e.Time, g.Cfg.Warmup+1)
+	if err != nil {
+		return nil, errors.Wrapf(err, "seeding the model of %s/%s", e.Currency, e.Quote)
+	}
+	m := &model{}
+	for _, r := range recent {
+		m.accept(r.Rate, g.Cfg.Alpha)
+	}
+	g.models[k] = m
+	return m, nil
+}
@@ -0,0 +1,81 @@
+package anomaly
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+type fakeStore struct {
+	recent      []entity.Exchrate
+	quarantined []entity.Quarantined
+}
+
+func (s *fakeStore) GetRecentExchrates(ctx context.Context, currency, quote, source string, before time.Time, n int) ([]entity.Exchrate, error) {
+	return s.recent, nil
+}
+
+func (s *fakeStore) QuarantineExchrate(ctx context.Context, q entity.Quarantined) (int64, error) {
+	s.quarantined = append(s.quarantined, q)
+	return int64(len(s.quarantined)), nil
+}
+
+func TestGuard(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2020, 3, 10, 0, 0, 0, 0, time.UTC)
+	rate := func(i int, value string) entity.Exchrate {
+		return entity.Exchrate{Time: start.Add(time.Duration(i) * time.Minute), Currency: "USD", Quote: entity.DefaultQuote,
+			Source: "test", Rate: decimal.RequireFromString(value)}
+	}
+
+	// the stored rates the model is seeded from move by 0.1% back and forth
+	store := &fakeStore{}
+	for i := 0; i < 10; i++ {
+		store.recent = append(store.recent, rate(i, []string{"75", "75.075"}[i%2]))
+	}
+	g := New(Config{Threshold: 6, Alpha: 0.1, Warmup: 5, MinDeviation: 0.001, Patience: 2}, store)
+	ctx := context.Background()
+
+	admitted, err := g.Admit(ctx, rate(10, "75.1"))
+	require.NoError(t, err)
+	assert.True(t, admitted)
+
+	// a tick a tenth off is quarantined, and so is the next one at that level
+	for i := 11; i <= 12; i++ {
+		admitted, err = g.Admit(ctx, rate(i, "82.6"))
+		require.NoError(t, err)
+		assert.False(t, admitted)
+	}
+	require.Len(t, store.quarantined, 2)
+	assert.True(t, decimal.RequireFromString("75.1").Equal(store.quarantined[0].Expected))
+	assert.Greater(t, store.quarantined[0].Score, 6.0)
+
+	// once the patience is over, the pair is taken to have moved
+	admitted, err = g.Admit(ctx, rate(13, "82.6"))
+	require.NoError(t, err)
+	assert.True(t, admitted)
+	admitted, err = g.Admit(ctx, rate(14, "82.65"))
+	require.NoError(t, err)
+	assert.True(t, admitted)
+}
+
+func TestGuardWarmup(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeStore{}
+	g := New(Config{Threshold: 6, Alpha: 0.1, Warmup: 5, MinDeviation: 0.001}, store)
+	for i, value := range []string{"75", "90", "60"} {
+		admitted, err := g.Admit(context.Background(), entity.Exchrate{Time: time.Unix(int64(i), 0), Currency: "USD",
+			Rate: decimal.RequireFromString(value)})
+		require.NoError(t, err)
+		assert.True(t, admitted, value)
+	}
+	assert.Empty(t, store.quarantined)
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/sys/service"
+)
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+type history struct {
+	averages []entity.Average
+	total    int
+}
+
+// Service caches the rates read through the service until they change, which it is told of by Invalidate,
+// or until the next poll is due, as the averages of the spans up to now move on with time.
+// The rates are expected to change once every TTL.
+type Service struct {
+	service.Service
+	TTL        time.Duration
+	MaxEntries int // how many reads are cached at most, 0 for none
+
+	mu       sync.Mutex
+	entries  map[string]entry
+	gen      uint64 // bumped by Invalidate, so that a read started before is not cached after
+	modified time.Time
+	now      func() time.Time
+}
+
+func New(s service.Service, ttl time.Duration, maxEntries int) *Service {
+	return &Service{
+		Service:    s,
+		TTL:        ttl,
+		MaxEntries: maxEntries,
+		entries:    map[string]entry{},
+		modified:   time.Now(),
+		now:        time.Now,
+	}
+}
+
+// Invalidate drops the cached reads once the rates have changed.
+func (c *Service) Invalidate(es []entity.Exchrate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]entry{}
+	c.gen++
+	c.modified = c.now()
+}
+
+// LastModified returns when the rates last changed, or when the service started if they have not since.
+func (c *Service) LastModified() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.modified
+}
+
+// NextChange returns when the rates are expected to change next: a whole number of TTLs after they last changed.
+func (c *Service) NextChange() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nextChange(c.now())
+}
+
+func (c *Service) nextChange(now time.Time) time.Time {
+	if c.TTL <= 0 {
+		return now
+	}
+	n := now.Sub(c.modified)/c.TTL + 1
+	return c.modified.Add(n * c.TTL)
+}
+
+// get returns the cached read of the key, or else the generation to put the read in
+func (c *Service) get(key string) (interface{}, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !c.now().Before(e.expires) {
+		return nil, c.gen, false
+	}
+	return e.value, c.gen, true
+}
+
+func (c *Service) put(key string, gen uint64, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.MaxEntries <= 0 || gen != c.gen {
+		return
+	}
+	if len(c.entries) >= c.MaxEntries {
+		c.entries = map[string]entry{}
+	}
+	now := c.now()
+	c.entries[key] = entry{value: value, expires: c.nextChange(now)}
+}
+
+func (c *Service) GetStatus(ctx context.Context, currency string) ([]decimal.Decimal, error) {
+	key := "status|" + currency
+	v, gen, ok := c.get(key)
+	if ok {
+		return v.([]decimal.Decimal), nil
+	}
+	rates, err := c.Service.GetStatus(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, gen, rates)
+	return rates, nil
+}
+
+func (c *Service) GetHistory(ctx context.Context, currency string, from, till time.Time, aggrType string, loc *time.Location, asOf time.Time, fill string, limit, offset uint64) ([]entity.Average, int, error) {
+	key := fmt.Sprintf("history|%s|%d|%d|%s|%s|%d|%s|%d|%d", currency, from.UnixNano(), till.UnixNano(), aggrType, loc, asOf.UnixNano(), fill, limit, offset)
+	v, gen, ok := c.get(key)
+	if ok {
+		h := v.(history)
+		return h.averages, h.total, nil
+	}
+	averages, total, err := c.Service.GetHistory(ctx, currency, from, till, aggrType, loc, asOf, fill, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.put(key, gen, history{averages, total})
+	return averages, total, nil
+}
+
+func (c *Service) GetMomental(ctx context.Context, currency string, moment, asOf time.Time) (decimal.Decimal, error) {
+	key := fmt.Sprintf("momental|%s|%d|%d", currency, moment.UnixNano(), asOf.UnixNano())
+	v, gen, ok := c.get(key)
+	if ok {
+		return v.(decimal.Decimal), nil
+	}
+	rate, err := c.Service.GetMomental(ctx, currency, moment, asOf)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	c.put(key, gen, rate)
+	return rate, nil
+}
+
+// the writes through the service change the rates as well
+
+func (c *Service) Import(ctx context.Context, format, conflictMode string, r io.Reader) (*entity.ImportReport, error) {
+	defer c.Invalidate(nil)
+	return c.Service.Import(ctx, format, conflictMode, r)
+}
+
+func (c *Service) Override(ctx context.Context, corr entity.Correction) error {
+	defer c.Invalidate(nil)
+	return c.Service.Override(ctx, corr)
+}
+
+func (c *Service) Void(ctx context.Context, corr entity.Correction) error {
+	defer c.Invalidate(nil)
+	return c.Service.Void(ctx, corr)
+}
+
+func (c *Service) Release(ctx context.Context, id int64, review entity.Review) error {
+	defer c.Invalidate(nil)
+	return c.Service.Release(ctx, id, review)
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nettyrnp/exch-rates/api/sys/service"
+)
+
+type countingService struct {
+	service.Service
+	calls int
+}
+
+func (s *countingService) GetStatus(ctx context.Context, currency string) ([]decimal.Decimal, error) {
+	s.calls++
+	return []decimal.Decimal{decimal.NewFromInt(int64(s.calls))}, nil
+}
+
+func TestService(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 3, 20, 12, 0, 0, 0, time.UTC)
+	inner := &countingService{}
+	c := New(inner, time.Minute, 10)
+	c.modified = now
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	status := func() string {
+		rates, err := c.GetStatus(ctx, "USD")
+		assert.NoError(t, err)
+		return rates[0].String()
+	}
+
+	assert.Equal(t, "1", status())
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, "1", status(), "cached till the next poll")
+	assert.Equal(t, now.Add(30*time.Second), c.NextChange())
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, "2", status(), "expired with the poll due")
+	assert.Equal(t, now.Add(time.Minute), c.NextChange(), "the polls go on even if the rates have not changed")
+
+	now = now.Add(10 * time.Second)
+	c.Invalidate(nil)
+	assert.Equal(t, now, c.LastModified())
+	assert.Equal(t, "3", status(), "dropped once the rates have changed")
+	assert.Equal(t, now.Add(time.Minute), c.NextChange())
+
+	_, gen, _ := c.get("status|EUR")
+	c.Invalidate(nil)
+	c.put("status|EUR", gen, []decimal.Decimal{decimal.Zero})
+	_, _, ok := c.get("status|EUR")
+	assert.False(t, ok, "a read started before the rates changed is not cached")
+}
@@ -0,0 +1,87 @@
+package compactor
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+)
+
+type Store interface {
+	Compact(ctx context.Context, now time.Time) (bool, error)
+}
+
+type Config struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// Compactor periodically applies the retention policy of the store.
+type Compactor struct {
+	Cfg         Config
+	Store       Store
+	OnCompacted func() // optional, called after the passes that purged any of the rates that are read
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+func New(cfg Config, store Store) *Compactor {
+	return &Compactor{
+		Cfg:   cfg,
+		Store: store,
+	}
+}
+
+func (c *Compactor) Start() {
+	if c.Cfg.Interval <= 0 || c.done != nil {
+		return
+	}
+	c.done = make(chan struct{})
+	c.stopped = make(chan struct{})
+	go c.run(c.done, c.stopped)
+}
+
+// Stop waits for the running pass, if any, to complete.
+func (c *Compactor) Stop() {
+	if c.done != nil {
+		close(c.done)
+		<-c.stopped
+		c.done, c.stopped = nil, nil
+	}
+}
+
+func (c *Compactor) run(done, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(c.Cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.RunOnce(context.Background()); err != nil {
+			common.LogError(err.Error())
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Compactor) RunOnce(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	purged, err := c.Store.Compact(ctx, start)
+	if err != nil {
+		return errors.Wrap(err, "compacting rates")
+	}
+	common.LogInfof("Compacted rates in %v", time.Since(start))
+	if purged && c.OnCompacted != nil {
+		c.OnCompacted()
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// the roles of the API clients, each one allowed everything the previous ones are
+const (
+	RoleReader   = "reader"   // reads the rates
+	RoleOperator = "operator" // runs the poller and corrects the rates
+	RoleAdmin    = "admin"    // imports the rates, reads the logs and manages the keys
+)
+
+var roleRanks = map[string]int{RoleReader: 1, RoleOperator: 2, RoleAdmin: 3}
+
+func IsRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAllows tells whether the role is allowed what the required role is.
+func RoleAllows(role, required string) bool {
+	return IsRole(role) && roleRanks[role] >= roleRanks[required]
+}
+
+// apiKeyPrefix marks the API keys, so that they are told from the other secrets at a glance
+const apiKeyPrefix = "xr_"
+
+// NewAPIKeySecret returns a new random API key.
+func NewAPIKeySecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating API key")
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// HashAPIKey returns the hash an API key is stored as. The keys are random, so a plain hash is as good as a slow one.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKey is a client of the API. Prefix is the beginning of the key, to tell the keys apart.
+type APIKey struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	Prefix    string     `json:"prefix"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// NewAPIKey is a key just created. The key itself is only ever shown then, as it is stored hashed.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// KeyPrefix returns the beginning of the key that is stored along with its hash.
+func KeyPrefix(key string) string {
+	if len(key) > len(apiKeyPrefix)+6 {
+		return key[:len(apiKeyPrefix)+6]
+	}
+	return key
+}
+
+func (k *APIKey) Validate() error {
+	if strings.TrimSpace(k.Name) == "" {
+		return errors.New("Name cannot be empty")
+	}
+	if !IsRole(k.Role) {
+		return errors.Errorf("unsupported role '%s'", k.Role)
+	}
+	return nil
+}
+
+// Principal is the client a request is made by.
+type Principal struct {
+	Name  string
+	Role  string
+	KeyID int64 // 0 unless authenticated with an API key
+}
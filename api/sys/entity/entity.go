@@ -1,9 +1,9 @@
 package entity
 
 import (
-	"fmt"
 	"github.com/nettyrnp/exch-rates/api/common"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 	"time"
 )
 
@@ -14,8 +14,32 @@ const (
 	Aggr1Day  = "1day"
 )
 
+const DefaultQuote = "RUB"
+
+// the ways the history fills the intervals that have no rates
+const (
+	FillNone     = "none"     // the intervals are left out
+	FillPrevious = "previous" // the average of the previous interval is carried forward
+	FillLinear   = "linear"   // the average is interpolated between the neighbouring intervals
+	FillNull     = "null"     // the intervals are kept with a null average
+)
+
+func IsFillMode(mode string) bool {
+	return mode == FillNone || mode == FillPrevious || mode == FillLinear || mode == FillNull
+}
+
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictError     = "error"
+)
+
 var ErrInvalidLine = errors.New("invalid line")
 
+func IsConflictMode(mode string) bool {
+	return mode == ConflictSkip || mode == ConflictOverwrite || mode == ConflictError
+}
+
 type ServiceKind string
 
 const (
@@ -24,28 +48,38 @@ const (
 
 type PollResult struct {
 	Rates struct {
-		RUB float64 `json:"RUB"`
+		RUB decimal.Decimal `json:"RUB"`
 	} `json:"rates"`
 	Base string `json:"base"`
 	Date string `json:"date"`
 }
 
+// Average is the average rate of an aggregation interval starting at Time. Filled tells that the interval has
+// no rates and Rate was filled in, Rate being null if there was nothing to fill it from.
 type Average struct {
-	Time time.Time
-	Rate float64
+	Time   time.Time           `json:"time"`
+	Rate   decimal.NullDecimal `json:"rate"`
+	Filled bool                `json:"filled"`
 }
 
-func (a *Average) String(timeFormat string) string {
-	t := a.Time.Format(timeFormat)
-	return fmt.Sprintf("%s - %.1f", t, a.Rate)
+// Bucket is a single aggregation interval of the rates of one currency.
+type Bucket struct {
+	Time     time.Time       `json:"time"`
+	Currency string          `json:"currency"`
+	Average  decimal.Decimal `json:"average"`
+	Min      decimal.Decimal `json:"min"`
+	Max      decimal.Decimal `json:"max"`
+	Count    int64           `json:"count"`
 }
 
 type Exchrate struct {
-	ID        int       `json:"-",db:"id"`
-	Time      time.Time `json:"time",db:"time"`
-	Currency  string    `json:"currency",db:"currency"`
-	Rate      float64   `json:"rate",db:"rate"`
-	CreatedAt time.Time `json:"createdAt",db:"created_at"`
+	ID        int             `json:"-" db:"id"`
+	Time      time.Time       `json:"time" db:"time"`
+	Currency  string          `json:"currency" db:"currency"`
+	Quote     string          `json:"quote" db:"quote"`
+	Rate      decimal.Decimal `json:"rate" db:"rate"`
+	Source    string          `json:"source" db:"source"`
+	CreatedAt time.Time       `json:"createdAt" db:"created_at"`
 }
 
 func (c *Exchrate) Validate() error {
@@ -56,7 +90,10 @@ func (c *Exchrate) Validate() error {
 	if c.Currency == "" {
 		errs = append(errs, errors.New("Currency cannot be empty"))
 	}
-	if c.Rate <= 0 {
+	if c.Quote == "" {
+		errs = append(errs, errors.New("Quote cannot be empty"))
+	}
+	if !c.Rate.IsPositive() {
 		errs = append(errs, errors.New("Rate should be positive"))
 	}
 	if len(errs) > 0 {
@@ -64,3 +101,78 @@ func (c *Exchrate) Validate() error {
 	}
 	return nil
 }
+
+// RejectedRow is a row of an imported file that was not stored.
+type RejectedRow struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+type ImportReport struct {
+	Total    int           `json:"total"`
+	Accepted int           `json:"accepted"`
+	Inserted int           `json:"inserted"`
+	Updated  int           `json:"updated"`
+	Rejected []RejectedRow `json:"rejected"`
+}
+
+func (r *ImportReport) Reject(line int, reason string) {
+	r.Rejected = append(r.Rejected, RejectedRow{Line: line, Reason: reason})
+}
+
+const (
+	VersionWrite    = "write"
+	VersionOverride = "override"
+	VersionVoid     = "void"
+)
+
+// Correction is a manual change of a stored rate: an override of its value or a void, made by Actor for Reason.
+// The rate is identified by its time, pair and source.
+type Correction struct {
+	Time     time.Time       `json:"time"`
+	Currency string          `json:"currency"`
+	Quote    string          `json:"quote"`
+	Source   string          `json:"source"`
+	Rate     decimal.Decimal `json:"rate"` // only for overrides
+	Actor    string          `json:"actor"`
+	Reason   string          `json:"reason"`
+}
+
+func (c *Correction) Exchrate() Exchrate {
+	return Exchrate{Time: c.Time, Currency: c.Currency, Quote: c.Quote, Rate: c.Rate, Source: c.Source}
+}
+
+func (c *Correction) Validate(kind string) error {
+	var errs []error
+	e := c.Exchrate()
+	if kind == VersionVoid {
+		e.Rate = decimal.NewFromInt(1) // a void needs no rate
+	}
+	if err := e.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Actor == "" {
+		errs = append(errs, errors.New("Actor cannot be empty"))
+	}
+	if c.Reason == "" {
+		errs = append(errs, errors.New("Reason cannot be empty"))
+	}
+	if len(errs) > 0 {
+		return common.JoinErrors(errs)
+	}
+	return nil
+}
+
+// RateVersion is a value a rate had from RecordedAt till SupersededAt.
+type RateVersion struct {
+	Time         time.Time       `json:"time"`
+	Currency     string          `json:"currency"`
+	Quote        string          `json:"quote"`
+	Source       string          `json:"source"`
+	Rate         decimal.Decimal `json:"rate"`
+	Kind         string          `json:"kind"`
+	Actor        string          `json:"actor,omitempty"`
+	Reason       string          `json:"reason,omitempty"`
+	RecordedAt   time.Time       `json:"recordedAt"`
+	SupersededAt *time.Time      `json:"supersededAt,omitempty"`
+}
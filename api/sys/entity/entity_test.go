@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrectionValidate(t *testing.T) {
+	t.Parallel()
+
+	c := Correction{Time: time.Now(), Currency: "USD", Quote: "RUB", Actor: "jdoe", Reason: "bad tick"}
+	assert.NoError(t, c.Validate(VersionVoid))
+	assert.Error(t, c.Validate(VersionOverride), "an override needs a rate")
+
+	c.Rate = decimal.RequireFromString("79.4")
+	assert.NoError(t, c.Validate(VersionOverride))
+
+	c.Reason = ""
+	assert.EqualError(t, c.Validate(VersionVoid), "Reason cannot be empty")
+}
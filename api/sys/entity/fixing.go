@@ -0,0 +1,96 @@
+package entity
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+)
+
+const (
+	FixingLast    = "last" // the last rate before the cut-off, averaged over the sources
+	FixingAverage = "avg"  // the average rate of the window before the cut-off
+)
+
+const DateFormat = "2006-01-02"
+
+// defaultFixingWindow is how far back the last rate before the cut-off is looked for
+const defaultFixingWindow = 24 * time.Hour
+
+// FixingSpec tells how the daily fixing of a pair is made: from the rates of the Window before the cut-off time
+// of the day in Location.
+type FixingSpec struct {
+	Currency string
+	Quote    string
+	Hour     int
+	Minute   int
+	Location *time.Location
+	Method   string
+	Window   time.Duration
+}
+
+// Cutoff returns the cut-off time of the day of date, which is taken in the location of the spec.
+func (s FixingSpec) Cutoff(date time.Time) time.Time {
+	y, m, d := date.Date()
+	return time.Date(y, m, d, s.Hour, s.Minute, 0, 0, s.Location)
+}
+
+// ParseFixingSpecs parses the fixings given as "BASE/QUOTE HH:MM TIMEZONE METHOD [WINDOW]",
+// e.g. "USD/RUB 16:00 Europe/Moscow last" or "EUR/RUB 16:00 Europe/Moscow avg 30m".
+func ParseFixingSpecs(items []string) ([]FixingSpec, error) {
+	var specs []FixingSpec
+	for _, item := range items {
+		fields := strings.Fields(item)
+		if len(fields) != 4 && len(fields) != 5 {
+			return nil, errors.Errorf("invalid fixing '%s'", item)
+		}
+
+		pair := strings.SplitN(strings.ToUpper(fields[0]), "/", 2)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return nil, errors.Errorf("invalid pair in fixing '%s'", item)
+		}
+		clock, err := time.Parse("15:04", fields[1])
+		if err != nil {
+			return nil, errors.Errorf("invalid cut-off time in fixing '%s'", item)
+		}
+		loc, err := common.ParseLocation(fields[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "fixing '%s'", item)
+		}
+		spec := FixingSpec{
+			Currency: pair[0],
+			Quote:    pair[1],
+			Hour:     clock.Hour(),
+			Minute:   clock.Minute(),
+			Location: loc,
+			Method:   fields[3],
+			Window:   defaultFixingWindow,
+		}
+		if spec.Method != FixingLast && spec.Method != FixingAverage {
+			return nil, errors.Errorf("unsupported method in fixing '%s'", item)
+		}
+		if len(fields) == 5 {
+			if spec.Window, err = time.ParseDuration(fields[4]); err != nil || spec.Window <= 0 {
+				return nil, errors.Errorf("invalid window in fixing '%s'", item)
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// Fixing is the official rate of a pair for a day. Once made, it never changes.
+type Fixing struct {
+	Date          string          `json:"date"`
+	Currency      string          `json:"currency"`
+	Quote         string          `json:"quote"`
+	Cutoff        time.Time       `json:"cutoff"`
+	Method        string          `json:"method"`
+	WindowSeconds int64           `json:"windowSeconds"`
+	Rate          decimal.Decimal `json:"rate"`
+	Samples       int64           `json:"samples"`
+	CreatedAt     time.Time       `json:"createdAt"`
+}
@@ -0,0 +1,31 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFixingSpecs(t *testing.T) {
+	t.Parallel()
+
+	specs, err := ParseFixingSpecs([]string{"usd/rub 15:30 Europe/Moscow last", "EUR/RUB 16:00 UTC avg 30m"})
+	require.NoError(t, err)
+	require.Len(t, specs, 2)
+	assert.Equal(t, "USD", specs[0].Currency)
+	assert.Equal(t, FixingLast, specs[0].Method)
+	assert.Equal(t, defaultFixingWindow, specs[0].Window)
+	assert.Equal(t, 30*time.Minute, specs[1].Window)
+
+	// the cut-off is taken on the calendar day of the date, in the location of the spec
+	cutoff := specs[0].Cutoff(time.Date(2020, 3, 20, 23, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2020, 3, 20, 12, 30, 0, 0, time.UTC), cutoff.UTC())
+
+	for _, invalid := range []string{"USD/RUB 15:30 UTC", "USD 15:30 UTC last", "USD/RUB 25:00 UTC last",
+		"USD/RUB 15:30 Mars/Base last", "USD/RUB 15:30 UTC median", "USD/RUB 15:30 UTC avg -1m"} {
+		_, err := ParseFixingSpecs([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,47 @@
+package entity
+
+import "time"
+
+// the states of the poller
+const (
+	PollerStopped = "stopped"
+	PollerRunning = "running"
+	PollerFailed  = "failed"  // stopped by an error
+	PollerStandby = "standby" // meant to run, but the replica does not lead
+)
+
+type PollerState struct {
+	State string    `json:"state"`
+	Since time.Time `json:"since"`
+	Error string    `json:"error,omitempty"`
+}
+
+// the statuses of a dependency and of the service as a whole
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+)
+
+// Check is the status of a dependency of the service.
+type Check struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Detail    string  `json:"detail,omitempty"`
+}
+
+// Health is the status of the dependencies of the service. The service is up, i.e. ready to serve, only if
+// all of them are.
+type Health struct {
+	Status  string    `json:"status"`
+	Checked time.Time `json:"checked"`
+	Uptime  string    `json:"uptime"`
+	Checks  []Check   `json:"checks"`
+}
+
+func (h *Health) Add(c Check) {
+	h.Checks = append(h.Checks, c)
+	if c.Status != HealthUp {
+		h.Status = HealthDown
+	}
+}
@@ -0,0 +1,22 @@
+package entity
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// LeaderStatus tells whether the replica leads, i.e. is the one that polls the rates.
+type LeaderStatus struct {
+	Enabled  bool       `json:"enabled"` // without the election, every replica leads
+	Leader   bool       `json:"leader"`
+	Identity string     `json:"identity"`
+	Since    *time.Time `json:"since,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// ReplicaIdentity tells the replica apart: its host name and process id.
+func ReplicaIdentity() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}
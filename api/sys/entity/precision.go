@@ -0,0 +1,99 @@
+package entity
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	RoundHalfUp   = "half_up"   // half away from zero
+	RoundHalfEven = "half_even" // banker's rounding
+	RoundUp       = "up"        // away from zero
+	RoundDown     = "down"      // towards zero
+	RoundCeil     = "ceil"
+	RoundFloor    = "floor"
+)
+
+func IsRoundingMode(mode string) bool {
+	switch mode {
+	case RoundHalfUp, RoundHalfEven, RoundUp, RoundDown, RoundCeil, RoundFloor:
+		return true
+	}
+	return false
+}
+
+// Precision tells how the rates of a pair are rounded when they are derived or presented:
+// to Scale digits after the point, with the Rounding mode.
+type Precision struct {
+	Scale    int32
+	Rounding string
+}
+
+func (p Precision) Round(d decimal.Decimal) decimal.Decimal {
+	switch p.Rounding {
+	case RoundHalfUp:
+		return d.Round(p.Scale)
+	case RoundUp:
+		return d.RoundUp(p.Scale)
+	case RoundDown:
+		return d.RoundDown(p.Scale)
+	case RoundCeil:
+		return d.RoundCeil(p.Scale)
+	case RoundFloor:
+		return d.RoundFloor(p.Scale)
+	default:
+		return d.RoundBank(p.Scale)
+	}
+}
+
+// Precisions holds the precision of the pairs, keyed by "BASE/QUOTE". Other pairs get the Default one.
+type Precisions struct {
+	Default Precision
+	Pairs   map[string]Precision
+}
+
+func (p Precisions) Of(currency, quote string) Precision {
+	if pr, ok := p.Pairs[strings.ToUpper(currency+"/"+quote)]; ok {
+		return pr
+	}
+	return p.Default
+}
+
+// ParsePrecisions parses the pair precisions given as "BASE/QUOTE=SCALE[:ROUNDING]", e.g. "USD/RUB=4:half_up".
+// A pair without a rounding mode gets the default one.
+func ParsePrecisions(def Precision, pairs []string) (Precisions, error) {
+	if !IsRoundingMode(def.Rounding) {
+		return Precisions{}, errors.Errorf("unsupported rounding mode '%s'", def.Rounding)
+	}
+	res := Precisions{Default: def, Pairs: make(map[string]Precision, len(pairs))}
+	for _, item := range pairs {
+		pair, spec := splitPair(item, "=")
+		if !strings.Contains(pair, "/") || spec == "" {
+			return Precisions{}, errors.Errorf("invalid pair precision '%s'", item)
+		}
+		scale, rounding := splitPair(spec, ":")
+		if rounding == "" {
+			rounding = def.Rounding
+		}
+		n, err := strconv.ParseInt(scale, 10, 32)
+		if err != nil || n < 0 {
+			return Precisions{}, errors.Errorf("invalid scale in pair precision '%s'", item)
+		}
+		if !IsRoundingMode(rounding) {
+			return Precisions{}, errors.Errorf("unsupported rounding mode in pair precision '%s'", item)
+		}
+		res.Pairs[strings.ToUpper(pair)] = Precision{Scale: int32(n), Rounding: rounding}
+	}
+	return res, nil
+}
+
+func splitPair(s, sep string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(s), sep, 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
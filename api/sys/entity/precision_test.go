@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrecisionRound(t *testing.T) {
+	t.Parallel()
+
+	for mode, expected := range map[string][]string{
+		RoundHalfUp:   {"2.13", "2.12", "-2.13"},
+		RoundHalfEven: {"2.12", "2.12", "-2.12"},
+		RoundUp:       {"2.13", "2.13", "-2.13"},
+		RoundDown:     {"2.12", "2.12", "-2.12"},
+		RoundCeil:     {"2.13", "2.13", "-2.12"},
+		RoundFloor:    {"2.12", "2.12", "-2.13"},
+	} {
+		p := Precision{Scale: 2, Rounding: mode}
+		for i, in := range []string{"2.125", "2.1201", "-2.125"} {
+			assert.Equal(t, expected[i], p.Round(decimal.RequireFromString(in)).String(), "%s of %s", mode, in)
+		}
+	}
+}
+
+func TestParsePrecisions(t *testing.T) {
+	t.Parallel()
+
+	def := Precision{Scale: 4, Rounding: RoundHalfEven}
+	p, err := ParsePrecisions(def, []string{"usd/rub=2:half_up", "EUR/RUB=6"})
+	require.NoError(t, err)
+	assert.Equal(t, Precision{Scale: 2, Rounding: RoundHalfUp}, p.Of("USD", "RUB"))
+	assert.Equal(t, Precision{Scale: 6, Rounding: RoundHalfEven}, p.Of("EUR", "RUB"))
+	assert.Equal(t, def, p.Of("GBP", "RUB"))
+
+	for _, invalid := range []string{"USD=2", "USD/RUB", "USD/RUB=x", "USD/RUB=2:nearest"} {
+		_, err := ParsePrecisions(def, []string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,76 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Poll is an attempt of the poller to get the rate of a pair from the provider. Error is empty if it succeeded.
+type Poll struct {
+	Time     time.Time
+	Currency string
+	Quote    string
+	Source   string
+	Error    string
+}
+
+// PollStat counts the polls of a pair from a source and the ones that failed.
+type PollStat struct {
+	Currency string
+	Quote    string
+	Source   string
+	Polls    int64
+	Errors   int64
+}
+
+// QualityReport tells how healthy the rates of the pairs were within [From, Till].
+type QualityReport struct {
+	From     time.Time     `json:"from"`
+	Till     time.Time     `json:"till"`
+	Interval string        `json:"interval"` // the poller interval the gaps are measured against
+	Pairs    []PairQuality `json:"pairs"`
+}
+
+// PairQuality lists the issues of the rates of a pair from a source.
+type PairQuality struct {
+	Currency   string     `json:"currency"`
+	Quote      string     `json:"quote"`
+	Source     string     `json:"source"`
+	Rates      int64      `json:"rates"`
+	Gaps       []Gap      `json:"gaps"`
+	Duplicates int64      `json:"duplicates"` // the rates polled less than half of the interval after the previous one
+	Jumps      []Jump     `json:"jumps"`
+	StaleRuns  []StaleRun `json:"staleRuns"`
+	Polls      int64      `json:"polls"`
+	PollErrors int64      `json:"pollErrors"`
+	ErrorRatio float64    `json:"errorRatio"`
+}
+
+// Healthy tells whether the pair has no issues.
+func (p PairQuality) Healthy() bool {
+	return len(p.Gaps) == 0 && p.Duplicates == 0 && len(p.Jumps) == 0 && len(p.StaleRuns) == 0 && p.PollErrors == 0
+}
+
+// Gap is a time range where Missing polled rates are missing.
+type Gap struct {
+	From    time.Time `json:"from"`
+	Till    time.Time `json:"till"`
+	Missing int64     `json:"missing"`
+}
+
+// Jump is a rate that differs from the previous one by more than allowed. Change is relative to the previous rate.
+type Jump struct {
+	Time   time.Time       `json:"time"`
+	From   decimal.Decimal `json:"from"`
+	To     decimal.Decimal `json:"to"`
+	Change decimal.Decimal `json:"change"`
+}
+
+// StaleRun is a run of Count rates in a row with the same value.
+type StaleRun struct {
+	From  time.Time       `json:"from"`
+	Till  time.Time       `json:"till"`
+	Rate  decimal.Decimal `json:"rate"`
+	Count int64           `json:"count"`
+}
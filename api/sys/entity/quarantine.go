@@ -0,0 +1,63 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+)
+
+// the states of a quarantined rate
+const (
+	QuarantinePending   = "pending"
+	QuarantineReleased  = "released"  // stored as a polled rate
+	QuarantineDiscarded = "discarded" // never stored
+)
+
+func IsQuarantineStatus(status string) bool {
+	return status == QuarantinePending || status == QuarantineReleased || status == QuarantineDiscarded
+}
+
+// Quarantined is a polled rate held back as suspicious rather than stored. Expected is the last rate of the pair
+// that was stored and Score tells how many deviations of the recent returns the return from Expected is.
+type Quarantined struct {
+	ID         int64           `json:"id"`
+	Time       time.Time       `json:"time"`
+	Currency   string          `json:"currency"`
+	Quote      string          `json:"quote"`
+	Source     string          `json:"source"`
+	Rate       decimal.Decimal `json:"rate"`
+	Expected   decimal.Decimal `json:"expected"`
+	Score      float64         `json:"score"`
+	Status     string          `json:"status"`
+	Actor      string          `json:"actor,omitempty"`
+	Reason     string          `json:"reason,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	ReviewedAt *time.Time      `json:"reviewedAt,omitempty"`
+}
+
+func (q *Quarantined) Exchrate() Exchrate {
+	return Exchrate{Time: q.Time, Currency: q.Currency, Quote: q.Quote, Rate: q.Rate, Source: q.Source}
+}
+
+// Review is a release or a discard of a quarantined rate, made by Actor for Reason.
+type Review struct {
+	Actor  string `json:"actor"`
+	Reason string `json:"reason"`
+}
+
+func (r *Review) Validate() error {
+	var errs []error
+	if r.Actor == "" {
+		errs = append(errs, errors.New("Actor cannot be empty"))
+	}
+	if r.Reason == "" {
+		errs = append(errs, errors.New("Reason cannot be empty"))
+	}
+	if len(errs) > 0 {
+		return common.JoinErrors(errs)
+	}
+	return nil
+}
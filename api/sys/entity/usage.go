@@ -0,0 +1,11 @@
+package entity
+
+// Usage is how much a client used the API on a day, in requests and in their cost, and how many of its
+// requests were turned down for going over the rate limit or the daily quota.
+type Usage struct {
+	Date     string `json:"date"`
+	Client   string `json:"client"`
+	Requests int64  `json:"requests"`
+	Cost     int64  `json:"cost"`
+	Rejected int64  `json:"rejected"`
+}
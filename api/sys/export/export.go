@@ -0,0 +1,208 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+const (
+	parquetRowGroupSize = 8 * 1024 * 1024
+	parquetParallelism  = 1
+)
+
+// Encoder writes exported rows to the underlying writer as they come.
+// Close must be called once all the rows are written.
+type Encoder interface {
+	EncodeExchrate(e entity.Exchrate) error
+	EncodeBucket(b entity.Bucket) error
+	Close() error
+}
+
+// NewEncoder creates an encoder of the given format. For the columnar format the schema
+// depends on whether raw rates or aggregated buckets are going to be written.
+func NewEncoder(format string, w io.Writer, aggregated bool) (Encoder, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVEncoder(w, aggregated), nil
+	case FormatNDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	case FormatParquet:
+		return newParquetEncoder(w, aggregated)
+	default:
+		return nil, errors.Errorf("unsupported export format '%s'", format)
+	}
+}
+
+func IsSupported(format string) bool {
+	switch format {
+	case FormatCSV, FormatNDJSON, FormatParquet:
+		return true
+	}
+	return false
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	header []string
+}
+
+func newCSVEncoder(w io.Writer, aggregated bool) *csvEncoder {
+	header := []string{"time", "currency", "quote", "rate", "source", "created_at"}
+	if aggregated {
+		header = []string{"time", "currency", "average", "min", "max", "count"}
+	}
+	return &csvEncoder{w: csv.NewWriter(w), header: header}
+}
+
+func (c *csvEncoder) writeHeader() error {
+	if c.header == nil {
+		return nil
+	}
+	err := c.w.Write(c.header)
+	c.header = nil
+	return err
+}
+
+func (c *csvEncoder) EncodeExchrate(e entity.Exchrate) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	return c.w.Write([]string{
+		e.Time.Format(time.RFC3339),
+		e.Currency,
+		e.Quote,
+		e.Rate.String(),
+		e.Source,
+		e.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+func (c *csvEncoder) EncodeBucket(b entity.Bucket) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	return c.w.Write([]string{
+		b.Time.Format(time.RFC3339),
+		b.Currency,
+		b.Average.String(),
+		b.Min.String(),
+		b.Max.String(),
+		strconv.FormatInt(b.Count, 10),
+	})
+}
+
+func (c *csvEncoder) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonEncoder) EncodeExchrate(e entity.Exchrate) error {
+	return n.enc.Encode(e)
+}
+
+func (n *ndjsonEncoder) EncodeBucket(b entity.Bucket) error {
+	return n.enc.Encode(b)
+}
+
+func (n *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// the rates are written as decimal strings, so that they stay exact
+type parquetExchrate struct {
+	Time      int64  `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Currency  string `parquet:"name=currency, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Quote     string `parquet:"name=quote, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Rate      string `parquet:"name=rate, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Source    string `parquet:"name=source, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	CreatedAt int64  `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+}
+
+type parquetBucket struct {
+	Time     int64  `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Currency string `parquet:"name=currency, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Average  string `parquet:"name=average, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Min      string `parquet:"name=min, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Max      string `parquet:"name=max, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Count    int64  `parquet:"name=count, type=INT64"`
+}
+
+// parquetEncoder keeps at most one row group in memory and flushes it to the writer once it is full.
+type parquetEncoder struct {
+	pw *writer.ParquetWriter
+}
+
+func newParquetEncoder(w io.Writer, aggregated bool) (*parquetEncoder, error) {
+	var schema interface{} = new(parquetExchrate)
+	if aggregated {
+		schema = new(parquetBucket)
+	}
+	pw, err := writer.NewParquetWriterFromWriter(w, schema, parquetParallelism)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating parquet writer")
+	}
+	pw.RowGroupSize = parquetRowGroupSize
+	return &parquetEncoder{pw: pw}, nil
+}
+
+func (p *parquetEncoder) EncodeExchrate(e entity.Exchrate) error {
+	return p.pw.Write(parquetExchrate{
+		Time:      toMillis(e.Time),
+		Currency:  e.Currency,
+		Quote:     e.Quote,
+		Rate:      e.Rate.String(),
+		Source:    e.Source,
+		CreatedAt: toMillis(e.CreatedAt),
+	})
+}
+
+func (p *parquetEncoder) EncodeBucket(b entity.Bucket) error {
+	return p.pw.Write(parquetBucket{
+		Time:     toMillis(b.Time),
+		Currency: b.Currency,
+		Average:  b.Average.String(),
+		Min:      b.Min.String(),
+		Max:      b.Max.String(),
+		Count:    b.Count,
+	})
+}
+
+func (p *parquetEncoder) Close() error {
+	return p.pw.WriteStop()
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
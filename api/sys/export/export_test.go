@@ -0,0 +1,71 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+func TestEncoders(t *testing.T) {
+	t.Parallel()
+
+	t.Run("csv raw", testCSVRaw)
+	t.Run("ndjson aggregated", testNDJSONAggregated)
+	t.Run("parquet", testParquet)
+	t.Run("unsupported format", testUnsupportedFormat)
+}
+
+func testCSVRaw(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(FormatCSV, &buf, false)
+	require.NoError(t, err)
+
+	tm := time.Date(2020, 3, 10, 15, 7, 30, 0, time.UTC)
+	require.NoError(t, enc.EncodeExchrate(entity.Exchrate{Time: tm, Currency: "USD", Quote: "RUB", Rate: decimal.RequireFromString("79.38426"), Source: "ecb", CreatedAt: tm}))
+	require.NoError(t, enc.Close())
+
+	expected := "time,currency,quote,rate,source,created_at\n" +
+		"2020-03-10T15:07:30Z,USD,RUB,79.38426,ecb,2020-03-10T15:07:30Z\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func testNDJSONAggregated(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(FormatNDJSON, &buf, true)
+	require.NoError(t, err)
+
+	tm := time.Date(2020, 3, 10, 15, 0, 0, 0, time.UTC)
+	d := decimal.NewFromInt
+	require.NoError(t, enc.EncodeBucket(entity.Bucket{Time: tm, Currency: "USD", Average: d(2), Min: d(1), Max: d(3), Count: 2}))
+	require.NoError(t, enc.EncodeBucket(entity.Bucket{Time: tm.Add(time.Hour), Currency: "USD", Average: d(4), Min: d(4), Max: d(4), Count: 1}))
+	require.NoError(t, enc.Close())
+
+	expected := `{"time":"2020-03-10T15:00:00Z","currency":"USD","average":"2","min":"1","max":"3","count":2}` + "\n" +
+		`{"time":"2020-03-10T16:00:00Z","currency":"USD","average":"4","min":"4","max":"4","count":1}` + "\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func testParquet(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewEncoder(FormatParquet, &buf, false)
+	require.NoError(t, err)
+
+	require.NoError(t, enc.EncodeExchrate(entity.Exchrate{Time: time.Now(), Currency: "USD", Rate: decimal.RequireFromString("79.4"), CreatedAt: time.Now()}))
+	require.NoError(t, enc.Close())
+
+	magic := []byte("PAR1")
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), magic))
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), magic))
+}
+
+func testUnsupportedFormat(t *testing.T) {
+	_, err := NewEncoder("xml", &bytes.Buffer{}, false)
+	assert.Error(t, err)
+	assert.False(t, IsSupported("xml"))
+}
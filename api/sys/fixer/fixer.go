@@ -0,0 +1,162 @@
+package fixer
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// divisionDigits are the extra digits an average is computed with before it is rounded to the precision of the pair
+const divisionDigits = 16
+
+type Store interface {
+	GetFixingSample(ctx context.Context, spec entity.FixingSpec, cutoff time.Time) (decimal.Decimal, int64, error)
+	AddFixing(ctx context.Context, f entity.Fixing) (bool, error)
+}
+
+type Config struct {
+	Interval time.Duration
+	Delay    time.Duration // lets the rates polled right before a cut-off land
+	Timeout  time.Duration
+}
+
+// Fixer periodically makes the daily fixings whose cut-off time has passed.
+type Fixer struct {
+	Cfg        Config
+	Store      Store
+	Specs      []entity.FixingSpec
+	Precisions entity.Precisions
+	done       chan struct{}
+	stopped    chan struct{}
+}
+
+func New(cfg Config, store Store, specs []entity.FixingSpec, precisions entity.Precisions) *Fixer {
+	return &Fixer{
+		Cfg:        cfg,
+		Store:      store,
+		Specs:      specs,
+		Precisions: precisions,
+	}
+}
+
+func (f *Fixer) Start() {
+	if f.Cfg.Interval <= 0 || len(f.Specs) == 0 || f.done != nil {
+		return
+	}
+	f.done = make(chan struct{})
+	f.stopped = make(chan struct{})
+	go f.run(f.done, f.stopped)
+}
+
+// Stop waits for the running pass, if any, to complete.
+func (f *Fixer) Stop() {
+	if f.done != nil {
+		close(f.done)
+		<-f.stopped
+		f.done, f.stopped = nil, nil
+	}
+}
+
+func (f *Fixer) run(done, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(f.Cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.RunOnce(context.Background()); err != nil {
+			common.LogError(err.Error())
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce makes the fixings of yesterday and today whose cut-off time has passed. The fixings already
+// made are left as they are.
+func (f *Fixer) RunOnce(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, f.Cfg.Timeout)
+	defer cancel()
+
+	now := time.Now()
+	var errs []error
+	for _, spec := range f.Specs {
+		today := now.In(spec.Location)
+		for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+			if spec.Cutoff(day).Add(f.Cfg.Delay).After(now) {
+				continue
+			}
+			if _, err := f.Fix(ctx, spec, day); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return common.JoinErrors(errs)
+	}
+	return nil
+}
+
+// FixDate makes the fixings of the date, given as '2006-01-02', e.g. to backfill the missed ones.
+func (f *Fixer) FixDate(ctx context.Context, date string) ([]entity.Fixing, error) {
+	var fixings []entity.Fixing
+	for _, spec := range f.Specs {
+		day, err := time.ParseInLocation(entity.DateFormat, date, spec.Location)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing date '%s'", date)
+		}
+		if spec.Cutoff(day).After(time.Now()) {
+			return nil, errors.Errorf("the cut-off of %s/%s on %s has not passed yet", spec.Currency, spec.Quote, date)
+		}
+		fixing, err := f.Fix(ctx, spec, day)
+		if err != nil {
+			return nil, err
+		}
+		if fixing != nil {
+			fixings = append(fixings, *fixing)
+		}
+	}
+	return fixings, nil
+}
+
+// Fix makes the fixing of the pair of the spec for the day. It returns nil if the pair is already fixed
+// for the day, and an error if there are no rates to fix it from.
+func (f *Fixer) Fix(ctx context.Context, spec entity.FixingSpec, day time.Time) (*entity.Fixing, error) {
+	cutoff := spec.Cutoff(day)
+	sum, count, err := f.Store.GetFixingSample(ctx, spec, cutoff)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting the rates to fix %s/%s at %v", spec.Currency, spec.Quote, cutoff)
+	}
+	if count == 0 {
+		return nil, errors.Errorf("no rates to fix %s/%s at %v", spec.Currency, spec.Quote, cutoff)
+	}
+
+	precision := f.Precisions.Of(spec.Currency, spec.Quote)
+	fixing := entity.Fixing{
+		Date:          day.Format(entity.DateFormat),
+		Currency:      spec.Currency,
+		Quote:         spec.Quote,
+		Cutoff:        cutoff,
+		Method:        spec.Method,
+		WindowSeconds: int64(spec.Window / time.Second),
+		Rate:          precision.Round(sum.DivRound(decimal.NewFromInt(count), precision.Scale+divisionDigits)),
+		Samples:       count,
+	}
+	added, err := f.Store.AddFixing(ctx, fixing)
+	if err != nil {
+		return nil, errors.Wrapf(err, "storing the fixing of %s/%s at %v", spec.Currency, spec.Quote, cutoff)
+	}
+	if !added {
+		return nil, nil
+	}
+	common.Log(ctx).Info("fixed rate", "currency", spec.Currency, "quote", spec.Quote, "cutoff", cutoff, "rate", fixing.Rate)
+	return &fixing, nil
+}
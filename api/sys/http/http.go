@@ -1,28 +1,65 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/logview"
+	"github.com/nettyrnp/exch-rates/api/middleware"
 	"github.com/nettyrnp/exch-rates/api/sys/dto"
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/sys/export"
+	"github.com/nettyrnp/exch-rates/api/sys/importer"
+	"github.com/nettyrnp/exch-rates/api/sys/repository"
 	"github.com/nettyrnp/exch-rates/api/sys/service"
 	"github.com/nettyrnp/exch-rates/config"
 	"github.com/pkg/errors"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// defaultQuarantineLimit is how many quarantined rates are listed if the request has no limit
+const defaultQuarantineLimit = 100
+
+const (
+	defaultLogLimit = 100
+	maxLogLimit     = 1000
+	maxLogOffset    = 100000
+
+	// logTailBuffer is how many records a slow client of the log tail may fall behind before it misses some
+	logTailBuffer    = 256
+	logTailHeartbeat = 15 * time.Second
+)
+
+// Freshness tells when the rates last changed and when they are expected to change next.
+type Freshness interface {
+	LastModified() time.Time
+	NextChange() time.Time
+}
+
 type Controller struct {
-	Kind    string
-	Service service.Service
-	Conf    config.Config
+	Kind      string
+	Service   service.Service
+	Conf      config.Config
+	Freshness Freshness // the service, if it tells
 }
 
 func New(s service.Service, conf config.Config, kind string) *Controller {
+	freshness, _ := s.(Freshness)
 	return &Controller{
-		Kind:    kind,
-		Service: s,
-		Conf:    conf,
+		Kind:      kind,
+		Service:   s,
+		Conf:      conf,
+		Freshness: freshness,
 	}
 }
 
@@ -31,23 +68,190 @@ func (c *Controller) Version(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(fmt.Sprintf("%s Service, version %s", c.Kind, v)))
 }
 
+// Healthz tells that the process is alive, checking nothing else.
+func (c *Controller) Healthz(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	svcResp.Body = map[string]string{"status": entity.HealthUp}
+	respondOK(w, r, svcResp, "")
+}
+
+// Readyz tells whether the service is ready to serve, responding with 503 if any of its dependencies is down.
+func (c *Controller) Readyz(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	ctx, cancel := context.WithTimeout(r.Context(), c.Conf.HealthTimeout)
+	defer cancel()
+
+	health := c.Service.GetHealth(ctx)
+	svcResp.Body = map[string]string{"status": health.Status}
+	if health.Status != entity.HealthUp {
+		var down []string
+		for _, check := range health.Checks {
+			if check.Status != entity.HealthUp {
+				down = append(down, check.Name+": "+check.Detail)
+			}
+		}
+		c.respondNotOK(w, r, http.StatusServiceUnavailable, svcResp, "not ready: "+strings.Join(down, "; "))
+		return
+	}
+	respondOK(w, r, svcResp, "")
+}
+
+// Health reports the status of each dependency of the service.
+func (c *Controller) Health(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	ctx, cancel := context.WithTimeout(r.Context(), c.Conf.HealthTimeout)
+	defer cancel()
+
+	svcResp.Body = c.Service.GetHealth(ctx)
+	respondOK(w, r, svcResp, "")
+}
+
+// Leader tells whether the replica leads, i.e. is the one that polls the rates.
+func (c *Controller) Leader(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	svcResp.Body = c.Service.GetLeader()
+	respondOK(w, r, svcResp, "")
+}
+
+// Logs returns a page of the records of the log file and its backups, newest first, selected by level, time range,
+// request id and substring.
 func (c *Controller) Logs(w http.ResponseWriter, r *http.Request) {
-	if c.Conf.AppEnv != config.AppEnvDev {
-		common.LogError("Attempt to access logs in non-development mode")
-		w.WriteHeader(http.StatusNotFound)
+	svcResp := dto.NewServiceResponse()
+
+	query, err := parseLogQuery(r)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, err.Error())
+		return
+	}
+	file := common.LogFile()
+	if file == "" {
+		c.respondNotOK(w, r, http.StatusNotFound, svcResp, "the logs are not written to a file, see LOG_SINKS")
+		return
+	}
+
+	page, err := logview.Search(file, query)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrap(err, "searching logs").Error())
 		return
 	}
+
+	svcResp.Body = page
+	respondOK(w, r, svcResp, "")
+}
+
+// TailLogs streams the records logged from now on as server-sent events, selected by level, request id and
+// substring, till the client goes away or the server shuts down.
+func (c *Controller) TailLogs(w http.ResponseWriter, r *http.Request) {
 	svcResp := dto.NewServiceResponse()
-	log, err := common.GetLog(c.Conf)
+
+	query, err := parseLogQuery(r)
 	if err != nil {
-		c.respondNotOK(w, http.StatusInternalServerError, svcResp, err.Error())
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, err.Error())
 		return
 	}
-	max := 5000
-	if len(log) > max {
-		log = "     <........... truncated ............>     \n" + log[len(log)-max:]
+	rc := http.NewResponseController(w)
+	// the tail lasts much longer than the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		common.Log(r.Context()).Error("resetting write deadline for log tail", "error", err)
 	}
-	w.Write([]byte("Backend latest log: \n" + log))
+
+	records, cancel := common.SubscribeLog(logTailBuffer)
+	defer cancel()
+	heartbeat := time.NewTicker(logTailHeartbeat)
+	defer heartbeat.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			// keeps the proxies from closing an idle stream
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case rec, ok := <-records:
+			if !ok {
+				return
+			}
+			rec = bytes.TrimRight(rec, "\n")
+			if !query.Match(rec) {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", rec)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// parseLogQuery parses the params of the log queries: level (the least one), from, to, request_id, q (substring),
+// limit and offset.
+func parseLogQuery(r *http.Request) (logview.Query, error) {
+	q := r.URL.Query()
+	query := logview.Query{
+		Level:     slog.LevelDebug,
+		RequestID: q.Get("request_id"),
+		Contains:  q.Get("q"),
+		Limit:     defaultLogLimit,
+	}
+
+	var err error
+	if s := q.Get("level"); s != "" {
+		if query.Level, err = logview.ParseLevel(s); err != nil {
+			return query, err
+		}
+	}
+	if s := q.Get("from"); s != "" {
+		if query.From, err = common.ParseTime(s, time.UTC); err != nil {
+			return query, errors.Wrapf(err, "parsing param from '%v'", s)
+		}
+	}
+	if s := q.Get("to"); s != "" {
+		if query.Till, err = common.ParseTime(s, time.UTC); err != nil {
+			return query, errors.Wrapf(err, "parsing param to '%v'", s)
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		if query.Limit, err = strconv.Atoi(s); err != nil || query.Limit < 1 || query.Limit > maxLogLimit {
+			return query, errors.Errorf("param limit '%v' is not within 1..%d", s, maxLogLimit)
+		}
+	}
+	if s := q.Get("offset"); s != "" {
+		if query.Offset, err = strconv.Atoi(s); err != nil || query.Offset < 0 || query.Offset > maxLogOffset {
+			return query, errors.Errorf("param offset '%v' is not within 0..%d", s, maxLogOffset)
+		}
+	}
+	return query, nil
+}
+
+// LogLevel returns the least level logged.
+func (c *Controller) LogLevel(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	svcResp.Body = logLevel{Level: common.Level()}
+	respondOK(w, r, svcResp, "")
+}
+
+// SetLogLevel changes the least level logged till the service is restarted, e.g. to debug a problem.
+func (c *Controller) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+
+	var req logLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrap(err, "parsing request body").Error())
+		return
+	}
+	if err := common.SetLevel(req.Level); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, err.Error())
+		return
+	}
+
+	svcResp.Body = logLevel{Level: common.Level()}
+	respondOK(w, r, svcResp, fmt.Sprintf("Set log level to %s by %s", common.Level(), clientOf(r)))
 }
 
 func (c *Controller) StartPolling(w http.ResponseWriter, r *http.Request) {
@@ -55,8 +259,8 @@ func (c *Controller) StartPolling(w http.ResponseWriter, r *http.Request) {
 
 	c.Service.StartPolling()
 
-	common.LogInfof("Started polling")
-	respondOK(w, svcResp, "Started polling")
+	common.Log(r.Context()).Info("started polling")
+	respondOK(w, r, svcResp, "Started polling")
 }
 
 func (c *Controller) StopPolling(w http.ResponseWriter, r *http.Request) {
@@ -64,8 +268,8 @@ func (c *Controller) StopPolling(w http.ResponseWriter, r *http.Request) {
 
 	c.Service.StopPolling()
 
-	common.LogInfof("Stopped polling")
-	respondOK(w, svcResp, "Stopped polling")
+	common.Log(r.Context()).Info("stopped polling")
+	respondOK(w, r, svcResp, "Stopped polling")
 }
 
 func (c *Controller) Status(w http.ResponseWriter, r *http.Request) {
@@ -74,7 +278,7 @@ func (c *Controller) Status(w http.ResponseWriter, r *http.Request) {
 
 	rates, err := c.Service.GetStatus(r.Context(), currencyName)
 	if err != nil {
-		c.respondNotOK(w, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "getting status for currency '%v'", currencyName).Error())
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "getting status for currency '%v'", currencyName).Error())
 		return
 	}
 
@@ -84,7 +288,7 @@ func (c *Controller) Status(w http.ResponseWriter, r *http.Request) {
 		WeekAverage:  rates[2],
 		MonthAverage: rates[3],
 	}
-	respondOK(w, svcResp, "")
+	c.respondFresh(w, r, svcResp)
 }
 
 func (c *Controller) History(w http.ResponseWriter, r *http.Request) {
@@ -92,24 +296,38 @@ func (c *Controller) History(w http.ResponseWriter, r *http.Request) {
 
 	var req historyReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		c.respondNotOK(w, http.StatusBadRequest, svcResp, errors.Wrap(err, "parsing request body").Error())
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrap(err, "parsing request body").Error())
 		return
 	}
 
-	from, err := common.ParseTime(req.From)
+	loc, err := common.ParseLocation(req.TZ)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param tz '%v'", req.TZ).Error())
+		return
+	}
+	from, err := common.ParseTime(req.From, loc)
 	if err != nil {
-		c.respondNotOK(w, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param From '%v'", req.From).Error())
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param From '%v'", req.From).Error())
 		return
 	}
-	till, err := common.ParseTime(req.To)
+	till, err := common.ParseTime(req.To, loc)
 	if err != nil {
-		c.respondNotOK(w, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param To '%v'", req.To).Error())
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param To '%v'", req.To).Error())
+		return
+	}
+	asOf, err := parseAsOf(req.AsOf, loc)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param asOf '%v'", req.AsOf).Error())
 		return
 	}
 
-	averages, total, err := c.Service.GetHistory(r.Context(), req.Currency, from, till, req.AggrType, req.Limit, req.Offset)
+	averages, total, err := c.Service.GetHistory(r.Context(), req.Currency, from, till, req.AggrType, loc, asOf, req.Fill, req.Limit, req.Offset)
+	if errors.Cause(err) == repository.ErrVersionsPurged {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, err.Error())
+		return
+	}
 	if err != nil {
-		c.respondNotOK(w, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "finding averages").Error())
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "finding averages").Error())
 		return
 	}
 
@@ -117,7 +335,7 @@ func (c *Controller) History(w http.ResponseWriter, r *http.Request) {
 		Averages: averages,
 		Total:    total,
 	}
-	respondOK(w, svcResp, "")
+	respondOK(w, r, svcResp, "")
 }
 
 func (c *Controller) Momental(w http.ResponseWriter, r *http.Request) {
@@ -125,50 +343,526 @@ func (c *Controller) Momental(w http.ResponseWriter, r *http.Request) {
 
 	var req momentalReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		c.respondNotOK(w, http.StatusBadRequest, svcResp, errors.Wrap(err, "parsing request body").Error())
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrap(err, "parsing request body").Error())
 		return
 	}
 
-	moment, err := common.ParseTime(req.Time)
+	loc, err := common.ParseLocation(req.TZ)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param tz '%v'", req.TZ).Error())
+		return
+	}
+	moment, err := common.ParseTime(req.Time, loc)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing %v param", req.Time).Error())
+		return
+	}
+	asOf, err := parseAsOf(req.AsOf, loc)
 	if err != nil {
-		c.respondNotOK(w, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing %v param", req.Time).Error())
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param asOf '%v'", req.AsOf).Error())
 		return
 	}
 
-	rate, err := c.Service.GetMomental(r.Context(), req.Currency, moment)
+	rate, err := c.Service.GetMomental(r.Context(), req.Currency, moment, asOf)
+	if err == repository.ErrVersionsPurged {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, err.Error())
+		return
+	}
 	if err != nil {
-		c.respondNotOK(w, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "finding exchange rate for moment %v", moment).Error())
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "finding exchange rate for moment %v", moment).Error())
 		return
 	}
 
 	svcResp.Body = &momentalResp{
 		Rate: rate,
 	}
-	respondOK(w, svcResp, "")
+	respondOK(w, r, svcResp, "")
+}
+
+func (c *Controller) Export(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	q := r.URL.Query()
+
+	loc, err := common.ParseLocation(q.Get("tz"))
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param tz '%v'", q.Get("tz")).Error())
+		return
+	}
+	from, err := common.ParseTime(q.Get("from"), loc)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param from '%v'", q.Get("from")).Error())
+		return
+	}
+	till, err := common.ParseTime(q.Get("to"), loc)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param to '%v'", q.Get("to")).Error())
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+
+	opts := service.ExportOpts{
+		Currencies: common.SplitList(q["currency"]),
+		From:       from,
+		Till:       till,
+		AggrType:   q.Get("aggrType"),
+		Format:     format,
+		Location:   loc,
+	}
+	if err := opts.Validate(); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, err.Error())
+		return
+	}
+
+	// exports may take much longer than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		common.Log(r.Context()).Error("resetting write deadline for export", "error", err)
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"exchrates.%s\"", format))
+	if err := c.Service.Export(r.Context(), opts, w); err != nil {
+		// the headers are already sent, so the client only gets a truncated file
+		common.Log(r.Context()).Error("exporting rates", "error", err)
+	}
+}
+
+func (c *Controller) Import(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = importer.FormatCSV
+	}
+	conflict := q.Get("conflict")
+	if conflict == "" {
+		conflict = entity.ConflictSkip
+	}
+	if !importer.IsSupported(format) || !entity.IsConflictMode(conflict) {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, fmt.Sprintf("unsupported format '%s' or conflict mode '%s'", format, conflict))
+		return
+	}
+
+	// big files may take much longer than the server timeouts
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		common.Log(r.Context()).Error("resetting read deadline for import", "error", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		common.Log(r.Context()).Error("resetting write deadline for import", "error", err)
+	}
+
+	report, err := c.Service.Import(r.Context(), format, conflict, r.Body)
+	if err == repository.ErrConflict {
+		svcResp.Body = report
+		c.respondNotOK(w, r, http.StatusConflict, svcResp, errors.Wrap(err, "importing rates").Error())
+		return
+	}
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrap(err, "importing rates").Error())
+		return
+	}
+
+	svcResp.Body = report
+	respondOK(w, r, svcResp, fmt.Sprintf("Imported %d of %d rates", report.Accepted, report.Total))
+}
+
+func (c *Controller) Override(w http.ResponseWriter, r *http.Request) {
+	c.correct(w, r, entity.VersionOverride, c.Service.Override)
+}
+
+func (c *Controller) Void(w http.ResponseWriter, r *http.Request) {
+	c.correct(w, r, entity.VersionVoid, c.Service.Void)
+}
+
+func (c *Controller) correct(w http.ResponseWriter, r *http.Request, kind string, fn func(ctx context.Context, corr entity.Correction) error) {
+	svcResp := dto.NewServiceResponse()
+
+	var corr entity.Correction
+	if err := json.NewDecoder(r.Body).Decode(&corr); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrap(err, "parsing request body").Error())
+		return
+	}
+	if corr.Quote == "" {
+		corr.Quote = entity.DefaultQuote
+	}
+	var err error
+	corr.Actor, err = c.actorOf(r, corr.Actor)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusForbidden, svcResp, err.Error())
+		return
+	}
+	if err := corr.Validate(kind); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, err.Error())
+		return
+	}
+
+	err = fn(r.Context(), corr)
+	if err == repository.ErrNotFound {
+		c.respondNotOK(w, r, http.StatusNotFound, svcResp, err.Error())
+		return
+	}
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "making %s", kind).Error())
+		return
+	}
+
+	common.Log(r.Context()).Info("corrected rate", "kind", kind, "currency", corr.Currency, "quote", corr.Quote,
+		"provider", corr.Source, "time", corr.Time, "actor", corr.Actor, "reason", corr.Reason)
+	respondOK(w, r, svcResp, fmt.Sprintf("Made %s of the rate", kind))
+}
+
+func (c *Controller) Versions(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	q := r.URL.Query()
+
+	tm, err := common.ParseTime(q.Get("time"), time.UTC)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param time '%v'", q.Get("time")).Error())
+		return
+	}
+	key := entity.Exchrate{Time: tm, Currency: q.Get("currency"), Quote: q.Get("quote"), Source: q.Get("source")}
+
+	versions, err := c.Service.GetVersions(r.Context(), key)
+	if err == repository.ErrNotFound {
+		c.respondNotOK(w, r, http.StatusNotFound, svcResp, err.Error())
+		return
+	}
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrap(err, "getting rate versions").Error())
+		return
+	}
+
+	svcResp.Body = versions
+	respondOK(w, r, svcResp, "")
+}
+
+func (c *Controller) Fixings(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	date := mux.Vars(r)["date"]
+	if _, err := time.Parse(entity.DateFormat, date); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing date '%v'", date).Error())
+		return
+	}
+
+	fixings, err := c.Service.GetFixings(r.Context(), date)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "getting fixings of %s", date).Error())
+		return
+	}
+	if len(fixings) == 0 {
+		c.respondNotOK(w, r, http.StatusNotFound, svcResp, fmt.Sprintf("no fixings of %s", date))
+		return
+	}
+
+	svcResp.Body = fixings
+	c.respondFresh(w, r, svcResp)
+}
+
+// Quality reports the quality of the rates within the range, the last day by default.
+func (c *Controller) Quality(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	q := r.URL.Query()
+
+	loc, err := common.ParseLocation(q.Get("tz"))
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param tz '%v'", q.Get("tz")).Error())
+		return
+	}
+	till := time.Now()
+	if q.Get("to") != "" {
+		if till, err = common.ParseTime(q.Get("to"), loc); err != nil {
+			c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param to '%v'", q.Get("to")).Error())
+			return
+		}
+	}
+	from := till.Add(-24 * time.Hour)
+	if q.Get("from") != "" {
+		if from, err = common.ParseTime(q.Get("from"), loc); err != nil {
+			c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param from '%v'", q.Get("from")).Error())
+			return
+		}
+	}
+
+	report, err := c.Service.GetQuality(r.Context(), common.SplitList(q["currency"]), from, till)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrap(err, "checking quality").Error())
+		return
+	}
+
+	svcResp.Body = report
+	respondOK(w, r, svcResp, "")
+}
+
+func (c *Controller) Quarantined(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	q := r.URL.Query()
+
+	limit, offset := uint64(defaultQuarantineLimit), uint64(0)
+	var err error
+	if s := q.Get("limit"); s != "" {
+		if limit, err = strconv.ParseUint(s, 10, 64); err != nil {
+			c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param limit '%v'", s).Error())
+			return
+		}
+	}
+	if s := q.Get("offset"); s != "" {
+		if offset, err = strconv.ParseUint(s, 10, 64); err != nil {
+			c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param offset '%v'", s).Error())
+			return
+		}
+	}
+
+	status := q.Get("status")
+	if status != "" && !entity.IsQuarantineStatus(status) {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, fmt.Sprintf("unsupported status '%s'", status))
+		return
+	}
+
+	quarantined, err := c.Service.GetQuarantined(r.Context(), status, limit, offset)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrap(err, "getting quarantined rates").Error())
+		return
+	}
+
+	svcResp.Body = quarantined
+	respondOK(w, r, svcResp, "")
+}
+
+func (c *Controller) Release(w http.ResponseWriter, r *http.Request) {
+	c.review(w, r, entity.QuarantineReleased, c.Service.Release)
+}
+
+func (c *Controller) Discard(w http.ResponseWriter, r *http.Request) {
+	c.review(w, r, entity.QuarantineDiscarded, c.Service.Discard)
+}
+
+func (c *Controller) review(w http.ResponseWriter, r *http.Request, status string, fn func(ctx context.Context, id int64, review entity.Review) error) {
+	svcResp := dto.NewServiceResponse()
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing id '%v'", mux.Vars(r)["id"]).Error())
+		return
+	}
+	var review entity.Review
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrap(err, "parsing request body").Error())
+		return
+	}
+	review.Actor, err = c.actorOf(r, review.Actor)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusForbidden, svcResp, err.Error())
+		return
+	}
+	if err := review.Validate(); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, err.Error())
+		return
+	}
+
+	err = fn(r.Context(), id, review)
+	if err == repository.ErrNotFound {
+		c.respondNotOK(w, r, http.StatusNotFound, svcResp, fmt.Sprintf("no pending quarantined rate %d", id))
+		return
+	}
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "reviewing quarantined rate %d", id).Error())
+		return
+	}
+
+	common.Log(r.Context()).Info("reviewed quarantined rate", "id", id, "status", status, "actor", review.Actor, "reason", review.Reason)
+	respondOK(w, r, svcResp, fmt.Sprintf("Quarantined rate %d %s", id, status))
+}
+
+func (c *Controller) Keys(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+
+	keys, err := c.Service.GetAPIKeys(r.Context())
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrap(err, "getting API keys").Error())
+		return
+	}
+
+	svcResp.Body = keys
+	respondOK(w, r, svcResp, "")
 }
 
-func (c *Controller) respondNotOK(w http.ResponseWriter, statusCode int, response *dto.ServiceResponse, errorMsg string) {
+func (c *Controller) CreateKey(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+
+	var req createKeyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrap(err, "parsing request body").Error())
+		return
+	}
+	k := entity.APIKey{Name: req.Name, Role: req.Role}
+	if err := k.Validate(); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, err.Error())
+		return
+	}
+
+	key, err := c.Service.CreateAPIKey(r.Context(), req.Name, req.Role)
+	if err == repository.ErrDuplicateName {
+		c.respondNotOK(w, r, http.StatusConflict, svcResp, err.Error())
+		return
+	}
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrap(err, "creating API key").Error())
+		return
+	}
+
+	svcResp.Body = key
+	respondOK(w, r, svcResp, fmt.Sprintf("Created %s API key %d for %s by %s", key.Role, key.ID, key.Name, clientOf(r)))
+}
+
+func (c *Controller) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing id '%v'", mux.Vars(r)["id"]).Error())
+		return
+	}
+
+	err = c.Service.RevokeAPIKey(r.Context(), id)
+	if err == repository.ErrNotFound {
+		c.respondNotOK(w, r, http.StatusNotFound, svcResp, fmt.Sprintf("no API key %d in use", id))
+		return
+	}
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "revoking API key %d", id).Error())
+		return
+	}
+
+	respondOK(w, r, svcResp, fmt.Sprintf("Revoked API key %d by %s", id, clientOf(r)))
+}
+
+// Usage reports the usage of the clients on the date given, today (UTC) by default.
+func (c *Controller) Usage(w http.ResponseWriter, r *http.Request) {
+	svcResp := dto.NewServiceResponse()
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().UTC().Format(entity.DateFormat)
+	}
+	if _, err := time.Parse(entity.DateFormat, date); err != nil {
+		c.respondNotOK(w, r, http.StatusBadRequest, svcResp, errors.Wrapf(err, "parsing param date '%v'", date).Error())
+		return
+	}
+
+	usage, err := c.Service.GetUsage(r.Context(), date)
+	if err != nil {
+		c.respondNotOK(w, r, http.StatusInternalServerError, svcResp, errors.Wrapf(err, "getting usage of %s", date).Error())
+		return
+	}
+
+	svcResp.Body = usage
+	respondOK(w, r, svcResp, "")
+}
+
+// clientOf returns the name of the client making the request, empty if the request is anonymous
+func clientOf(r *http.Request) string {
+	if p := middleware.PrincipalFrom(r.Context()); p != nil {
+		return p.Name
+	}
+	return ""
+}
+
+// actorOf returns the client making the request as the actor of a change. The actor given in the request body
+// is taken only with the authentication disabled, when there is no client to tell, and is refused otherwise
+// unless it names the client.
+func (c *Controller) actorOf(r *http.Request, given string) (string, error) {
+	client := clientOf(r)
+	if !c.Conf.AuthEnabled && given != "" {
+		return given, nil
+	}
+	if given != "" && given != client {
+		return "", errors.Errorf("the actor '%s' is not the client '%s' making the request", given, client)
+	}
+	return client, nil
+}
+
+// parseAsOf parses the optional knowledge time of a query, zero standing for the current knowledge
+func parseAsOf(s string, loc *time.Location) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return common.ParseTime(s, loc)
+}
+
+func (c *Controller) respondNotOK(w http.ResponseWriter, r *http.Request, statusCode int, response *dto.ServiceResponse, errorMsg string) {
 	if c.Conf.AppEnv == config.AppEnvDev {
-		respondNotOKWithError(w, statusCode, response, errorMsg)
+		respondNotOKWithError(w, r, statusCode, response, errorMsg)
 		return
 	}
-	common.LogError(errorMsg)
+	common.Log(r.Context()).Error(errorMsg)
 	respond(w, statusCode, response, "")
 }
 
-func respondNotOKWithError(w http.ResponseWriter, statusCode int, response *dto.ServiceResponse, errorMsg string) {
-	common.LogError(errorMsg)
+func respondNotOKWithError(w http.ResponseWriter, r *http.Request, statusCode int, response *dto.ServiceResponse, errorMsg string) {
+	common.Log(r.Context()).Error(errorMsg)
 	respond(w, statusCode, response, errorMsg)
 }
 
-func respondOK(w http.ResponseWriter, response *dto.ServiceResponse, msg string) {
+func respondOK(w http.ResponseWriter, r *http.Request, response *dto.ServiceResponse, msg string) {
 	if msg != "" {
-		common.LogInfo(msg)
+		common.Log(r.Context()).Info(msg)
 	}
 	statusCode := http.StatusOK
 	respond(w, statusCode, response, msg)
 }
 
+// respondFresh responds along with the validators of the response and how long it may be cached, which is till
+// the rates are expected to change. A client that has the response already gets 304 instead.
+func (c *Controller) respondFresh(w http.ResponseWriter, r *http.Request, response *dto.ServiceResponse) {
+	response.Status.Code = http.StatusOK
+	jsonResponse, _ := json.Marshal(*response)
+	sum := sha256.Sum256(jsonResponse)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	var modified time.Time
+	if c.Freshness != nil {
+		modified = c.Freshness.LastModified()
+		maxAge := math.Ceil(time.Until(c.Freshness.NextChange()).Seconds())
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(math.Max(maxAge, 0))))
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// notModified tells whether the client has the response of the validators already. If-Modified-Since is
+// only looked at without If-None-Match, as the ETag is the stronger one.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
 func respond(w http.ResponseWriter, statusCode int, response *dto.ServiceResponse, msg string) {
 	response.Status.Code = statusCode
 	response.Status.Text = msg
@@ -1,31 +1,50 @@
 package http
 
+import (
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/shopspring/decimal"
+)
+
 type historyReq struct {
 	Currency string `json:"currency"`
 	From     string `json:"from"`
 	To       string `json:"to"`
 	AggrType string `json:"aggrType"`
+	TZ       string `json:"tz"`
+	AsOf     string `json:"asOf"`
+	Fill     string `json:"fill"`
 	Limit    uint64 `json:"limit"`
 	Offset   uint64 `json:"offset"`
 }
 
 type historyResp struct {
-	Averages []string `json:"averages"`
-	Total    int      `json:"total"`
+	Averages []entity.Average `json:"averages"`
+	Total    int              `json:"total"`
 }
 
 type momentalReq struct {
 	Currency string `json:"currency"`
 	Time     string `json:"time"`
+	TZ       string `json:"tz"`
+	AsOf     string `json:"asOf"`
 }
 
 type momentalResp struct {
-	Rate float64 `json:"rate"`
+	Rate decimal.Decimal `json:"rate"`
 }
 
 type statusResp struct {
-	MostRecent   float64 `json:"most_recent"`
-	DayAverage   float64 `json:"day_average"`
-	WeekAverage  float64 `json:"week_average"`
-	MonthAverage float64 `json:"month_average"`
+	MostRecent   decimal.Decimal `json:"most_recent"`
+	DayAverage   decimal.Decimal `json:"day_average"`
+	WeekAverage  decimal.Decimal `json:"week_average"`
+	MonthAverage decimal.Decimal `json:"month_average"`
+}
+
+type createKeyReq struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type logLevel struct {
+	Level string `json:"level"`
 }
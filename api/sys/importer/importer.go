@@ -0,0 +1,183 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+const maxLineSize = 1024 * 1024
+
+// Row is a decoded line of an imported file. Err is set when the line cannot be parsed,
+// in which case the line is to be rejected while the rest of the file is still imported.
+type Row struct {
+	Line     int
+	Exchrate entity.Exchrate
+	Err      error
+}
+
+// Decoder reads the rows of an imported file one by one. Next returns io.EOF after the last row.
+type Decoder interface {
+	Next() (Row, error)
+}
+
+func NewDecoder(format string, r io.Reader) (Decoder, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVDecoder(r), nil
+	case FormatNDJSON:
+		s := bufio.NewScanner(r)
+		s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		return &ndjsonDecoder{s: s}, nil
+	default:
+		return nil, errors.Errorf("unsupported import format '%s'", format)
+	}
+}
+
+func IsSupported(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON
+}
+
+// FormatOf guesses the format of a file by its extension.
+func FormatOf(fname string) string {
+	if strings.HasSuffix(fname, ".ndjson") || strings.HasSuffix(fname, ".jsonl") {
+		return FormatNDJSON
+	}
+	return FormatCSV
+}
+
+type csvDecoder struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVDecoder(r io.Reader) *csvDecoder {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+	return &csvDecoder{r: cr}
+}
+
+func (d *csvDecoder) readHeader() error {
+	header, err := d.r.Read()
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return errors.Wrap(err, "reading csv header")
+	}
+	d.columns = make(map[string]int, len(header))
+	for i, name := range header {
+		d.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"time", "base", "rate"} {
+		if _, ok := d.columns[name]; !ok {
+			return errors.Errorf("csv header has no '%s' column", name)
+		}
+	}
+	return nil
+}
+
+func (d *csvDecoder) Next() (Row, error) {
+	if d.columns == nil {
+		if err := d.readHeader(); err != nil {
+			return Row{}, err
+		}
+	}
+	record, err := d.r.Read()
+	if err == io.EOF {
+		return Row{}, io.EOF
+	}
+	if err != nil {
+		if pErr, ok := err.(*csv.ParseError); ok {
+			return Row{Line: pErr.StartLine, Err: pErr.Err}, nil
+		}
+		return Row{}, errors.Wrap(err, "reading csv")
+	}
+	line, _ := d.r.FieldPos(0)
+
+	field := func(name string) string {
+		if i, ok := d.columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	e, err := toExchrate(field("time"), field("base"), field("quote"), field("rate"), field("source"))
+	return Row{Line: line, Exchrate: e, Err: err}, nil
+}
+
+type ndjsonDecoder struct {
+	s    *bufio.Scanner
+	line int
+}
+
+type ndjsonRow struct {
+	Time   string      `json:"time"`
+	Base   string      `json:"base"`
+	Quote  string      `json:"quote"`
+	Rate   json.Number `json:"rate"`
+	Source string      `json:"source"`
+}
+
+func (d *ndjsonDecoder) Next() (Row, error) {
+	for d.s.Scan() {
+		d.line++
+		data := strings.TrimSpace(d.s.Text())
+		if data == "" {
+			continue
+		}
+		var r ndjsonRow
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return Row{Line: d.line, Err: err}, nil
+		}
+		e, err := toExchrate(r.Time, r.Base, r.Quote, r.Rate.String(), r.Source)
+		return Row{Line: d.line, Exchrate: e, Err: err}, nil
+	}
+	if err := d.s.Err(); err != nil {
+		return Row{}, errors.Wrap(err, "reading ndjson")
+	}
+	return Row{}, io.EOF
+}
+
+func toExchrate(t, base, quote, rate, source string) (entity.Exchrate, error) {
+	e := entity.Exchrate{
+		Currency: strings.ToUpper(base),
+		Quote:    strings.ToUpper(quote),
+		Source:   source,
+	}
+	if e.Quote == "" {
+		e.Quote = entity.DefaultQuote
+	}
+	if e.Quote != entity.DefaultQuote {
+		return e, errors.Errorf("unsupported quote '%s', the rates are only read in %s", e.Quote, entity.DefaultQuote)
+	}
+
+	var err error
+	if e.Time, err = parseTime(t); err != nil {
+		return e, errors.Wrapf(err, "parsing time '%s'", t)
+	}
+	if e.Rate, err = decimal.NewFromString(rate); err != nil {
+		return e, errors.Wrapf(err, "parsing rate '%s'", rate)
+	}
+	return e, e.Validate()
+}
+
+// parseTime takes the times without a zone in UTC
+func parseTime(s string) (time.Time, error) {
+	t, err := common.ParseTime(s, time.UTC)
+	return t.UTC(), err
+}
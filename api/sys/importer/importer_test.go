@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoders(t *testing.T) {
+	t.Parallel()
+
+	t.Run("csv", testCSV)
+	t.Run("csv without required column", testCSVMissingColumn)
+	t.Run("ndjson", testNDJSON)
+}
+
+func readAll(t *testing.T, dec Decoder) []Row {
+	var rows []Row
+	for {
+		row, err := dec.Next()
+		if err == io.EOF {
+			return rows
+		}
+		require.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func testCSV(t *testing.T) {
+	in := "time,base,quote,rate,source\n" +
+		"2020-03-10T15:07:30Z,usd,RUB,79.38426,ecb\n" +
+		"2020-03-10 16:07:30,EUR,,86.7,\n" +
+		"yesterday,USD,RUB,79.4,ecb\n" +
+		"2020-03-10T17:07:30Z,USD,RUB,-1,ecb\n" +
+		"2020-03-10T17:07:30Z,USD\n" +
+		"2020-03-10T17:07:30Z,USD,EUR,0.92,ecb\n"
+
+	dec, err := NewDecoder(FormatCSV, strings.NewReader(in))
+	require.NoError(t, err)
+	rows := readAll(t, dec)
+	require.Len(t, rows, 6)
+
+	require.NoError(t, rows[0].Err)
+	assert.Equal(t, 2, rows[0].Line)
+	assert.Equal(t, "USD", rows[0].Exchrate.Currency)
+	assert.Equal(t, "79.38426", rows[0].Exchrate.Rate.String())
+	assert.Equal(t, "ecb", rows[0].Exchrate.Source)
+	assert.Equal(t, time.Date(2020, 3, 10, 15, 7, 30, 0, time.UTC), rows[0].Exchrate.Time)
+
+	require.NoError(t, rows[1].Err)
+	assert.Equal(t, "RUB", rows[1].Exchrate.Quote)
+
+	assert.Error(t, rows[2].Err)
+	assert.Error(t, rows[3].Err)
+	assert.Error(t, rows[4].Err)
+	assert.Equal(t, 6, rows[4].Line)
+	assert.Error(t, rows[5].Err, "rates of other quotes are not read back")
+}
+
+func testCSVMissingColumn(t *testing.T) {
+	dec, err := NewDecoder(FormatCSV, strings.NewReader("time,quote,rate\n"))
+	require.NoError(t, err)
+	_, err = dec.Next()
+	assert.Error(t, err)
+}
+
+func testNDJSON(t *testing.T) {
+	in := `{"time":"2020-03-10T15:07:30Z","base":"USD","quote":"RUB","rate":79.38426,"source":"ecb"}` + "\n" +
+		"\n" +
+		`{"time":"2020-03-10T15:07:30Z","base":"USD","rate":` + "\n"
+
+	dec, err := NewDecoder(FormatNDJSON, strings.NewReader(in))
+	require.NoError(t, err)
+	rows := readAll(t, dec)
+	require.Len(t, rows, 2)
+
+	require.NoError(t, rows[0].Err)
+	assert.Equal(t, "79.38426", rows[0].Exchrate.Rate.String())
+	assert.Error(t, rows[1].Err)
+	assert.Equal(t, 3, rows[1].Line)
+}
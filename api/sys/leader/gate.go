@@ -0,0 +1,143 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/sys/poller"
+)
+
+// Intent keeps whether the poller is meant to run, shared by the replicas, so that starting or stopping the poller
+// on any of them holds for the leader, and for the one that takes over after it.
+type Intent interface {
+	Wanted(ctx context.Context) (bool, error)
+	SetWanted(ctx context.Context, wanted bool) error
+}
+
+// Gate runs the poller only while the replica leads. Starting and stopping the gate tells whether the poller
+// is meant to run at all, the same as without the leader election, where it only runs once started.
+type Gate struct {
+	Poller  poller.Poller
+	Intent  Intent // nil keeps the intent in the replica
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	wanted  bool
+	leading bool
+
+	runMu sync.Mutex // keeps the starts and the stops of the poller, made with mu released, in order
+}
+
+// NewGate returns a gate of the poller, which is not meant to run until the gate is started.
+func NewGate(p poller.Poller, intent Intent, timeout time.Duration) *Gate {
+	return &Gate{Poller: p, Intent: intent, Timeout: timeout}
+}
+
+func (g *Gate) Start() {
+	g.mu.Lock()
+	g.setWanted(true)
+	g.mu.Unlock()
+	g.apply()
+}
+
+func (g *Gate) Stop() {
+	g.mu.Lock()
+	g.setWanted(false)
+	g.mu.Unlock()
+	g.apply()
+}
+
+func (g *Gate) State() entity.PollerState {
+	g.mu.Lock()
+	changed := g.sync()
+	g.mu.Unlock()
+	if changed {
+		g.apply()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st := g.Poller.State()
+	if g.wanted && !g.leading {
+		st.State = entity.PollerStandby
+	}
+	return st
+}
+
+func (g *Gate) Elected() {
+	g.mu.Lock()
+	g.leading = true
+	g.sync()
+	g.mu.Unlock()
+	g.apply()
+}
+
+// Leading starts or stops the poller of the leader as another replica was told since.
+func (g *Gate) Leading() {
+	g.mu.Lock()
+	changed := g.sync()
+	g.mu.Unlock()
+	if changed {
+		g.apply()
+	}
+}
+
+func (g *Gate) Demoted() {
+	g.mu.Lock()
+	g.leading = false
+	g.mu.Unlock()
+	g.apply()
+}
+
+// apply starts the poller if it is meant to run while the replica leads, and stops it otherwise. It is called
+// with the mutex released, as stopping the poller waits for its running tick, and takes the state anew once
+// the previous start or stop is over, so that the last change holds.
+func (g *Gate) apply() {
+	g.runMu.Lock()
+	defer g.runMu.Unlock()
+
+	g.mu.Lock()
+	run, p := g.wanted && g.leading, g.Poller
+	g.mu.Unlock()
+	if run {
+		p.Start()
+	} else {
+		p.Stop()
+	}
+}
+
+// setWanted keeps the intent, in the replica if it cannot be shared. It is called with the mutex held.
+func (g *Gate) setWanted(wanted bool) {
+	g.wanted = wanted
+	if g.Intent == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), g.Timeout)
+	defer cancel()
+	if err := g.Intent.SetWanted(ctx, wanted); err != nil {
+		common.LogErrorf("sharing the poller intent: %v", err)
+	}
+}
+
+// sync takes the shared intent, telling whether it changed, so that the poller is to be started or stopped.
+// It is called with the mutex held.
+func (g *Gate) sync() bool {
+	if g.Intent == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), g.Timeout)
+	defer cancel()
+	wanted, err := g.Intent.Wanted(ctx)
+	if err != nil {
+		common.LogErrorf("reading the poller intent: %v", err)
+		return false
+	}
+	if wanted == g.wanted {
+		return false
+	}
+	g.wanted = wanted
+	return true
+}
@@ -0,0 +1,169 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// Lock is held by the leader, and lost with its connection to the store.
+type Lock interface {
+	Check(ctx context.Context) error
+	Release(ctx context.Context) error
+}
+
+// Store hands the lock to one replica at a time. TryLock returns nil if another replica holds it.
+type Store interface {
+	TryLock(ctx context.Context, key int64) (Lock, error)
+}
+
+type Config struct {
+	Key      int64 // the same for the replicas that elect one leader
+	Interval time.Duration
+	Timeout  time.Duration
+	Identity string // tells the replica apart in the logs and the status
+}
+
+// Follower is told when the replica is elected and when it is demoted, and on every interval it keeps leading.
+type Follower interface {
+	Elected()
+	Leading()
+	Demoted()
+}
+
+// Elector periodically tries to take the lock, which makes the replica the leader, and, once it has the lock,
+// checks that it still does. A leader that dies loses the lock with its connection, and another replica takes
+// it within an interval.
+type Elector struct {
+	Cfg      Config
+	Store    Store
+	Follower Follower
+
+	mu      sync.Mutex
+	lock    Lock
+	since   time.Time
+	lastErr error
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func New(cfg Config, store Store, follower Follower) *Elector {
+	return &Elector{
+		Cfg:      cfg,
+		Store:    store,
+		Follower: follower,
+	}
+}
+
+func (e *Elector) Start() {
+	if e.Cfg.Interval <= 0 || e.done != nil {
+		return
+	}
+	e.done = make(chan struct{})
+	e.stopped = make(chan struct{})
+	go e.run(e.done, e.stopped)
+}
+
+// Stop steps down, if the replica leads, so that another one takes over right away.
+func (e *Elector) Stop() {
+	if e.done != nil {
+		close(e.done)
+		<-e.stopped
+		e.done, e.stopped = nil, nil
+	}
+
+	e.mu.Lock()
+	leads := e.lock != nil
+	e.mu.Unlock()
+	if leads {
+		e.stepDown(nil)
+	}
+}
+
+func (e *Elector) run(done, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(e.Cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		e.RunOnce(context.Background())
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce takes the lock if it is free, or checks that the lock taken before is still held. The follower is
+// told with the mutex released, as it may wait for the poller, so RunOnce is not to be called along with Stop
+// or another RunOnce, which the elector itself never does.
+func (e *Elector) RunOnce(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, e.Cfg.Timeout)
+	defer cancel()
+
+	e.mu.Lock()
+	lock := e.lock
+	e.mu.Unlock()
+
+	if lock != nil {
+		if err := lock.Check(ctx); err != nil {
+			common.LogErrorf("%s lost the leadership: %v", e.Cfg.Identity, err)
+			e.stepDown(err)
+			return
+		}
+		e.Follower.Leading()
+		return
+	}
+
+	lock, err := e.Store.TryLock(ctx, e.Cfg.Key)
+	e.mu.Lock()
+	e.lastErr = err
+	if err == nil && lock != nil {
+		e.lock, e.since = lock, time.Now()
+	}
+	e.mu.Unlock()
+	if err != nil {
+		common.LogErrorf("%s taking the leadership: %v", e.Cfg.Identity, err)
+		return
+	}
+	if lock == nil {
+		return
+	}
+	common.LogInfof("%s is the leader", e.Cfg.Identity)
+	e.Follower.Elected()
+}
+
+// stepDown demotes the replica and then lets go of the lock, so that the poller is stopped before another
+// replica may take over. It is called with the mutex released.
+func (e *Elector) stepDown(cause error) {
+	e.Follower.Demoted()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), e.Cfg.Timeout)
+	defer cancel()
+	if err := e.lock.Release(ctx); err != nil && cause == nil {
+		common.LogError(err.Error())
+	}
+	e.lock, e.since, e.lastErr = nil, time.Time{}, cause
+}
+
+func (e *Elector) Status() entity.LeaderStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st := entity.LeaderStatus{Enabled: true, Leader: e.lock != nil, Identity: e.Cfg.Identity}
+	if e.lock != nil {
+		since := e.since
+		st.Since = &since
+	}
+	if e.lastErr != nil {
+		st.Error = e.lastErr.Error()
+	}
+	return st
+}
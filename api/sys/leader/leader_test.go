@@ -0,0 +1,129 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+type fakeLock struct {
+	store *fakeStore
+	lost  bool
+}
+
+func (l *fakeLock) Check(ctx context.Context) error {
+	if l.lost {
+		return errors.New("connection lost")
+	}
+	return nil
+}
+
+func (l *fakeLock) Release(ctx context.Context) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.holder == l {
+		l.store.holder = nil
+	}
+	return nil
+}
+
+type fakeStore struct {
+	mu     sync.Mutex
+	holder *fakeLock
+}
+
+func (s *fakeStore) TryLock(ctx context.Context, key int64) (Lock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder != nil {
+		return nil, nil
+	}
+	s.holder = &fakeLock{store: s}
+	return s.holder, nil
+}
+
+// lose drops the lock as the db does once the connection of the holder is gone
+func (s *fakeStore) lose() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.holder.lost = true
+	s.holder = nil
+}
+
+type fakePoller struct {
+	state string
+}
+
+func (p *fakePoller) Start() { p.state = entity.PollerRunning }
+func (p *fakePoller) Stop()  { p.state = entity.PollerStopped }
+func (p *fakePoller) State() entity.PollerState {
+	return entity.PollerState{State: p.state}
+}
+
+// fakeIntent is the intent the replicas share through the db
+type fakeIntent struct {
+	mu     sync.Mutex
+	wanted bool
+}
+
+func (i *fakeIntent) Wanted(ctx context.Context) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.wanted, nil
+}
+
+func (i *fakeIntent) SetWanted(ctx context.Context, wanted bool) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.wanted = wanted
+	return nil
+}
+
+func TestElector(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store, intent := &fakeStore{}, &fakeIntent{}
+	cfg := Config{Key: 1, Timeout: time.Second}
+	p1, p2 := &fakePoller{state: entity.PollerStopped}, &fakePoller{state: entity.PollerStopped}
+	g1, g2 := NewGate(p1, intent, time.Second), NewGate(p2, intent, time.Second)
+	e1, e2 := New(cfg, store, g1), New(cfg, store, g2)
+
+	e1.RunOnce(ctx)
+	e2.RunOnce(ctx)
+	assert.True(t, e1.Status().Leader)
+	assert.False(t, e2.Status().Leader)
+	assert.Equal(t, entity.PollerStopped, p1.state, "the leader does not poll until the poller is started")
+	assert.Equal(t, entity.PollerStopped, g2.State().State)
+
+	g2.Start()
+	assert.Equal(t, entity.PollerStopped, p2.state)
+	assert.Equal(t, entity.PollerStandby, g2.State().State)
+	e1.RunOnce(ctx)
+	assert.Equal(t, entity.PollerRunning, p1.state, "the leader polls once any replica is started")
+
+	store.lose()
+	e2.RunOnce(ctx)
+	e1.RunOnce(ctx)
+	assert.True(t, e2.Status().Leader, "another replica takes over")
+	assert.False(t, e1.Status().Leader)
+	assert.Equal(t, "connection lost", e1.Status().Error)
+	assert.Equal(t, entity.PollerStopped, p1.state, "the demoted replica stops polling")
+	assert.Equal(t, entity.PollerRunning, p2.state)
+
+	g1.Stop()
+	e2.RunOnce(ctx)
+	assert.Equal(t, entity.PollerStopped, p2.state, "the leader stops once any replica is stopped")
+
+	e2.Stop()
+	assert.False(t, e2.Status().Leader)
+	e1.RunOnce(ctx)
+	assert.True(t, e1.Status().Leader, "the lock is released on stop")
+	assert.Equal(t, entity.PollerStopped, p1.state, "the stop holds across the failover")
+}
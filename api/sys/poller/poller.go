@@ -3,99 +3,218 @@ package poller
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/metrics"
 	"github.com/nettyrnp/exch-rates/api/sys/entity"
-	"github.com/nettyrnp/exch-rates/api/sys/repository"
+	"github.com/nettyrnp/exch-rates/api/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
 type Config struct {
 	Currencies []string
 	URL        string
+	Interval   time.Duration
 	Timeout    time.Duration
+	Source     string
+}
+
+// Journal records the attempts of the poller.
+type Journal interface {
+	AddPoll(ctx context.Context, p entity.Poll) error
+}
+
+// Guard tells whether a polled rate may be stored, holding back the ones that may not.
+type Guard interface {
+	Admit(ctx context.Context, e entity.Exchrate) (bool, error)
 }
 
 type Poller interface {
 	Start()
 	Stop()
+	State() entity.PollerState
 }
 
 type RatesPoller struct {
 	Cfg     Config
-	Repo    *repository.RDBMSRepository
+	Writer  *BatchWriter
+	Journal Journal // optional
+	Guard   Guard   // optional
 	Ticker  *time.Ticker
 	start   time.Time
-	Done    chan bool
+	Done    chan bool // closed to stop the poller
 	ErrorCh chan error
+
+	mu      sync.Mutex
+	state   entity.PollerState
+	stopped chan struct{}
 }
 
 func (a *RatesPoller) Start() {
+	a.mu.Lock()
+	if a.state.State == entity.PollerRunning {
+		a.mu.Unlock()
+		return
+	}
 	a.start = time.Now()
+	a.state = entity.PollerState{State: entity.PollerRunning, Since: a.start}
+	done, stopped := make(chan bool), make(chan struct{})
+	a.Done, a.stopped = done, stopped
+	a.mu.Unlock()
+
+	if a.Cfg.Interval > 0 {
+		a.Ticker.Reset(a.Cfg.Interval)
+	}
+	a.Writer.Start()
 
-	go a.startRequester()
+	go a.startRequester(done, stopped)
 
-	go a.watchErrors()
+	go a.watchErrors(done)
 }
 
+// Stop lets the running tick complete and then stores the rates buffered by the writer.
 func (a *RatesPoller) Stop() {
+	a.stop(nil)
+}
+
+// stop stops the poller, as failed if there is a cause
+func (a *RatesPoller) stop(cause error) {
+	a.mu.Lock()
+	if a.state.State != entity.PollerRunning {
+		a.mu.Unlock()
+		return
+	}
+	a.state = entity.PollerState{State: entity.PollerStopped, Since: time.Now()}
+	if cause != nil {
+		a.state.State, a.state.Error = entity.PollerFailed, cause.Error()
+	}
+	done, stopped := a.Done, a.stopped
+	a.mu.Unlock()
+
+	close(done)
+	<-stopped
 	a.Ticker.Stop()
 
+	if err := a.Writer.Stop(); err != nil {
+		common.LogError(errors.Wrap(err, "flushing polled rates").Error())
+	}
+
 	common.LogInfof("Stopped poller. Elapsed time: %v", (time.Since(a.start)))
+}
 
-	a.Done <- true
+// State tells whether the poller is running, and if it is not, whether it was stopped by an error.
+func (a *RatesPoller) State() entity.PollerState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state.State == "" {
+		return entity.PollerState{State: entity.PollerStopped}
+	}
+	return a.state
 }
 
-func (a *RatesPoller) watchErrors() {
-	for {
-		select {
-		case <-a.Done:
-			return
-		case err := <-a.ErrorCh:
-			log.Println(err)
-			a.Stop()
-		}
+func (a *RatesPoller) watchErrors(done chan bool) {
+	select {
+	case <-done:
+	case err := <-a.ErrorCh:
+		common.Log(context.Background()).Error("poller stopped by an error", "error", err)
+		a.stop(err)
 	}
 }
 
-func (a *RatesPoller) startRequester() {
+func (a *RatesPoller) startRequester(done chan bool, stopped chan struct{}) {
+	defer close(stopped)
+
 	for {
 		select {
-		case <-a.Done:
+		case <-done:
 			return
 		case <-a.Ticker.C:
 			for _, currency := range a.Cfg.Currencies {
-				if err := a.makeRequest(context.Background(), currency); err != nil {
-					common.LogError(err.Error())
-					a.ErrorCh <- errors.WithStack(err)
+				start := time.Now()
+				ctx := common.WithLog(context.Background(), "currency", currency, "provider", a.Cfg.Source)
+				err := a.makeRequest(ctx, currency)
+				metrics.ObservePoll(currency, start, err)
+				a.record(ctx, currency, err)
+				if err != nil {
+					select {
+					case a.ErrorCh <- errors.WithStack(err):
+					case <-done:
+					}
 				}
 			}
 		}
 	}
 }
 
-func (a *RatesPoller) makeRequest(ctx context.Context, currency string) error {
+func (a *RatesPoller) makeRequest(ctx context.Context, currency string) (err error) {
+	ctx, span := tracing.Start(ctx, "poller.poll", attribute.String("currency", currency))
+	defer func() {
+		if err != nil {
+			common.Log(ctx).Error("polling failed", "error", err)
+		}
+		tracing.End(span, err)
+	}()
 	ctx, cancel := context.WithTimeout(ctx, a.Cfg.Timeout)
 	defer cancel()
 
-	res, err := doRequest(ctx, a.Cfg.URL+currency)
+	res, err := doRequest(ctx, a.Cfg.URL+currency, a.Cfg.Source)
 	if err != nil {
 		return errors.Wrapf(err, "getting poll response")
 	}
+	metrics.ObserveRate(res.Currency, res.Quote, res.Rate, res.Time)
+
+	if a.Guard != nil {
+		admitted, err := a.Guard.Admit(ctx, *res)
+		if err != nil {
+			common.Log(ctx).Error("checking polled rate", "error", err)
+		}
+		if !admitted {
+			return nil
+		}
+	}
 
-	return a.Repo.AddExchrate(ctx, res)
+	a.Writer.Add(*res)
+	return nil
 }
 
-func doRequest(ctx context.Context, url string) (*entity.Exchrate, error) {
-	resp, err := http.Get(url)
+func (a *RatesPoller) record(ctx context.Context, currency string, pollErr error) {
+	if a.Journal == nil {
+		return
+	}
+	p := entity.Poll{Time: time.Now(), Currency: currency, Quote: entity.DefaultQuote, Source: a.Cfg.Source}
+	if pollErr != nil {
+		p.Error = pollErr.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.Cfg.Timeout)
+	defer cancel()
+	if err := a.Journal.AddPoll(ctx, p); err != nil {
+		common.Log(ctx).Error("recording poll", "error", err)
+	}
+}
+
+func doRequest(ctx context.Context, url, source string) (*entity.Exchrate, error) {
+	ctx, span := tracing.Start(ctx, "GET upstream", semconv.HTTPMethod(http.MethodGet), semconv.HTTPURL(url))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "making http request")
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, errors.Wrapf(err, "doing http request")
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
 
 	var pollResult entity.PollResult
 	data, err := ioutil.ReadAll(resp.Body)
@@ -105,12 +224,12 @@ func doRequest(ctx context.Context, url string) (*entity.Exchrate, error) {
 	if err := json.Unmarshal(data, &pollResult); err != nil {
 		return nil, errors.Wrapf(err, "unmarshalling http request")
 	}
-	fmt.Printf("\npoll result: %v\n", pollResult)
+	common.Log(ctx).Debug("polled", "base", pollResult.Base, "date", pollResult.Date, "rate", pollResult.Rates.RUB)
 
-	return toExchrate(pollResult)
+	return toExchrate(pollResult, source)
 }
 
-func toExchrate(p entity.PollResult) (*entity.Exchrate, error) {
+func toExchrate(p entity.PollResult, source string) (*entity.Exchrate, error) {
 
 	// Commented out temporarily, because the web-site often returns rates for previous days
 	//t, err := toTime(p.Date)
@@ -122,7 +241,9 @@ func toExchrate(p entity.PollResult) (*entity.Exchrate, error) {
 	return &entity.Exchrate{
 		Time:     t,
 		Currency: p.Base,
+		Quote:    entity.DefaultQuote,
 		Rate:     p.Rates.RUB,
+		Source:   source,
 	}, nil
 }
 
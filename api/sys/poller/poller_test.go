@@ -0,0 +1,70 @@
+package poller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+func newTestPoller(url string, store *fakeStore) *RatesPoller {
+	return &RatesPoller{
+		Cfg: Config{
+			Currencies: []string{"USD", "EUR"},
+			URL:        url + "/",
+			Interval:   10 * time.Millisecond,
+			Timeout:    time.Second,
+			Source:     "test",
+		},
+		Writer:  NewBatchWriter(store, 100, time.Hour, time.Second, nil),
+		Ticker:  time.NewTicker(time.Hour),
+		ErrorCh: make(chan error),
+	}
+}
+
+func TestRatesPollerStop(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"base": "%s", "rates": {"RUB": 75.5}}`, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer srv.Close()
+
+	store := &fakeStore{}
+	p := newTestPoller(srv.URL, store)
+	p.Start()
+	assert.Equal(t, entity.PollerRunning, p.State().State)
+	assert.Eventually(t, func() bool { return p.Writer.Buffered() >= 2 }, time.Second, time.Millisecond)
+
+	p.Stop()
+	assert.Equal(t, entity.PollerStopped, p.State().State)
+	assert.Zero(t, p.Writer.Buffered(), "the buffered rates are stored on stop")
+	assert.Equal(t, 0, store.count()%2, "the running tick completes")
+
+	p.Stop()
+	p.Start()
+	assert.Equal(t, entity.PollerRunning, p.State().State, "the poller may be started again")
+	p.Stop()
+}
+
+func TestRatesPollerFailure(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer srv.Close()
+
+	p := newTestPoller(srv.URL, &fakeStore{})
+	p.Start()
+	assert.Eventually(t, func() bool { return p.State().State == entity.PollerFailed }, time.Second, time.Millisecond)
+	assert.Contains(t, p.State().Error, "unmarshalling")
+	p.Stop()
+	assert.Equal(t, entity.PollerFailed, p.State().State, "stopping a failed poller changes nothing")
+}
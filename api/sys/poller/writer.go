@@ -0,0 +1,166 @@
+package poller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/sys/repository"
+)
+
+type Store interface {
+	AddExchrates(ctx context.Context, es []entity.Exchrate) error
+}
+
+// BatchWriter buffers the polled rates and stores them in batches, once MaxSize rates are buffered
+// or FlushInterval has passed. Rates are stored in the order they were added, which keeps the order per pair.
+// If the store fails, the batch stays buffered for the next flush, and the oldest rates are dropped
+// once more than MaxBuffered are waiting. Every failure, including the rejected rates, is passed to OnError,
+// and every batch stored, even if in part, is passed to OnStored.
+type BatchWriter struct {
+	Store         Store
+	MaxSize       int
+	MaxBuffered   int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+	OnError       func(err error)
+	OnStored      func(es []entity.Exchrate) // optional
+
+	mu      sync.Mutex
+	buf     []entity.Exchrate
+	full    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+
+	flushMu sync.Mutex
+}
+
+func NewBatchWriter(store Store, maxSize int, flushInterval, timeout time.Duration, onError func(err error)) *BatchWriter {
+	return &BatchWriter{
+		Store:         store,
+		MaxSize:       maxSize,
+		MaxBuffered:   maxSize * 10,
+		FlushInterval: flushInterval,
+		Timeout:       timeout,
+		OnError:       onError,
+		full:          make(chan struct{}, 1),
+	}
+}
+
+func (w *BatchWriter) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done != nil {
+		return
+	}
+	w.done = make(chan struct{})
+	w.stopped = make(chan struct{})
+	go w.run(w.done, w.stopped)
+}
+
+// Stop waits for the running flush to complete and then stores whatever is left in the buffer.
+func (w *BatchWriter) Stop() error {
+	w.mu.Lock()
+	done, stopped := w.done, w.stopped
+	w.done, w.stopped = nil, nil
+	w.mu.Unlock()
+
+	if done != nil {
+		close(done)
+		<-stopped
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.Timeout)
+	defer cancel()
+	return w.Flush(ctx)
+}
+
+func (w *BatchWriter) Add(e entity.Exchrate) {
+	w.mu.Lock()
+	w.buf = append(w.buf, e)
+	isFull := len(w.buf) >= w.MaxSize
+	w.mu.Unlock()
+
+	if isFull {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Buffered returns the number of rates waiting to be stored.
+func (w *BatchWriter) Buffered() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.buf)
+}
+
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.buf
+	w.buf = nil
+	w.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := w.Store.AddExchrates(ctx, batch)
+	if err == nil {
+		w.stored(batch)
+		return nil
+	}
+	if _, ok := err.(*repository.BatchError); ok {
+		// the rejected rates would be rejected again, so they are not retried
+		w.stored(batch)
+		return err
+	}
+
+	w.mu.Lock()
+	w.buf = append(batch, w.buf...)
+	var dropped int
+	if w.MaxBuffered > 0 && len(w.buf) > w.MaxBuffered {
+		dropped = len(w.buf) - w.MaxBuffered
+		w.buf = w.buf[dropped:]
+	}
+	w.mu.Unlock()
+
+	if dropped > 0 {
+		return errors.Wrapf(err, "storing %d rates, dropped %d oldest ones", len(batch), dropped)
+	}
+	return errors.Wrapf(err, "storing %d rates, will retry", len(batch))
+}
+
+func (w *BatchWriter) stored(batch []entity.Exchrate) {
+	if w.OnStored != nil {
+		w.OnStored(batch)
+	}
+}
+
+func (w *BatchWriter) run(done, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(w.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		case <-w.full:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), w.Timeout)
+		if err := w.Flush(ctx); err != nil && w.OnError != nil {
+			w.OnError(err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,99 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/sys/repository"
+)
+
+type fakeStore struct {
+	mu      sync.Mutex
+	stored  []entity.Exchrate
+	batches int
+	err     error
+}
+
+func (s *fakeStore) AddExchrates(ctx context.Context, es []entity.Exchrate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.batches++
+	s.stored = append(s.stored, es...)
+	return nil
+}
+
+func (s *fakeStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.stored)
+}
+
+func rate(currency string, v float64) entity.Exchrate {
+	return entity.Exchrate{Time: time.Now(), Currency: currency, Quote: entity.DefaultQuote, Rate: decimal.NewFromFloat(v)}
+}
+
+func TestBatchWriter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("flushes by size", testFlushBySize)
+	t.Run("keeps order and retries", testRetry)
+	t.Run("does not retry rejected rates", testRejected)
+}
+
+func testFlushBySize(t *testing.T) {
+	store := &fakeStore{}
+	w := NewBatchWriter(store, 2, time.Hour, time.Second, nil)
+	w.Start()
+
+	w.Add(rate("USD", 1))
+	w.Add(rate("EUR", 2))
+	assert.Eventually(t, func() bool { return store.count() == 2 }, time.Second, 10*time.Millisecond)
+
+	w.Add(rate("USD", 3))
+	require.NoError(t, w.Stop())
+	assert.Equal(t, 3, store.count())
+	assert.Equal(t, 2, store.batches)
+}
+
+func testRetry(t *testing.T) {
+	store := &fakeStore{err: errors.New("db is down")}
+	w := NewBatchWriter(store, 10, time.Hour, time.Second, nil)
+	w.MaxBuffered = 3
+
+	w.Add(rate("USD", 1))
+	w.Add(rate("USD", 2))
+	assert.Error(t, w.Flush(context.Background()))
+	assert.Equal(t, 2, w.Buffered())
+
+	w.Add(rate("USD", 3))
+	w.Add(rate("USD", 4))
+	assert.Error(t, w.Flush(context.Background()))
+	assert.Equal(t, 3, w.Buffered())
+
+	store.err = nil
+	require.NoError(t, w.Flush(context.Background()))
+	require.Len(t, store.stored, 3)
+	for i, e := range store.stored {
+		assert.True(t, decimal.NewFromInt(int64(i+2)).Equal(e.Rate))
+	}
+}
+
+func testRejected(t *testing.T) {
+	store := &fakeStore{err: &repository.BatchError{Failed: []repository.FailedExchrate{{Exchrate: rate("USD", 0), Err: errors.New("Rate should be positive")}}}}
+	w := NewBatchWriter(store, 10, time.Hour, time.Second, nil)
+
+	w.Add(rate("USD", 0))
+	assert.Error(t, w.Flush(context.Background()))
+	assert.Equal(t, 0, w.Buffered())
+}
@@ -0,0 +1,88 @@
+package quality
+
+import (
+	"context"
+	"time"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+)
+
+type CheckerConfig struct {
+	Interval   time.Duration // the checks run and look back this often
+	Timeout    time.Duration
+	Currencies []string
+}
+
+// Checker periodically checks the quality of the rates polled since the previous check and logs the issues.
+type Checker struct {
+	Cfg     CheckerConfig
+	Quality Config
+	Store   Store
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func NewChecker(cfg CheckerConfig, quality Config, store Store) *Checker {
+	return &Checker{
+		Cfg:     cfg,
+		Quality: quality,
+		Store:   store,
+	}
+}
+
+func (c *Checker) Start() {
+	if c.Cfg.Interval <= 0 || len(c.Cfg.Currencies) == 0 || c.done != nil {
+		return
+	}
+	c.done = make(chan struct{})
+	c.stopped = make(chan struct{})
+	go c.run(c.done, c.stopped)
+}
+
+// Stop waits for the running pass, if any, to complete.
+func (c *Checker) Stop() {
+	if c.done != nil {
+		close(c.done)
+		<-c.stopped
+		c.done, c.stopped = nil, nil
+	}
+}
+
+func (c *Checker) run(done, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(c.Cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if err := c.RunOnce(context.Background()); err != nil {
+			common.LogError(err.Error())
+		}
+	}
+}
+
+func (c *Checker) RunOnce(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Cfg.Timeout)
+	defer cancel()
+
+	till := time.Now()
+	report, err := Check(ctx, c.Store, c.Quality, c.Cfg.Currencies, till.Add(-c.Cfg.Interval), till)
+	if err != nil {
+		return err
+	}
+	for _, p := range report.Pairs {
+		if p.Healthy() {
+			continue
+		}
+		common.Log(ctx).Warn("poor quality of rates",
+			"currency", p.Currency, "quote", p.Quote, "provider", p.Source, "since", report.From,
+			"gaps", len(p.Gaps), "duplicates", p.Duplicates, "jumps", len(p.Jumps), "stale_runs", len(p.StaleRuns),
+			"failed_polls", p.PollErrors, "polls", p.Polls)
+	}
+	return nil
+}
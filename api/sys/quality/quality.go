@@ -0,0 +1,196 @@
+package quality
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/sys/repository"
+)
+
+// gapTolerance is how many poller intervals may pass between two rates before the rates in between count as missing
+const gapTolerance = 1.5
+
+type Store interface {
+	StreamExchrates(ctx context.Context, opts repository.ExportQueryOpts, fn func(e entity.Exchrate) error) error
+	GetPollStats(ctx context.Context, currencies []string, from, till time.Time) ([]entity.PollStat, error)
+}
+
+type Config struct {
+	PollerInterval time.Duration
+	MaxJump        decimal.Decimal // the largest change of a rate relative to the previous one that is not a jump
+	StaleCount     int             // how many rates in a row with the same value make a stale run, 0 to not look for them
+}
+
+// Check makes the quality report of the raw rates of the currencies within [from, till].
+func Check(ctx context.Context, store Store, cfg Config, currencies []string, from, till time.Time) (*entity.QualityReport, error) {
+	a := NewAnalyzer(cfg, from, till)
+	err := store.StreamExchrates(ctx, repository.ExportQueryOpts{Currencies: currencies, From: from, Till: till}, func(e entity.Exchrate) error {
+		a.Add(e)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading rates")
+	}
+
+	stats, err := store.GetPollStats(ctx, currencies, from, till)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading polls")
+	}
+	for _, s := range stats {
+		a.AddPolls(s)
+	}
+
+	for _, c := range currencies {
+		a.Expect(c, entity.DefaultQuote)
+	}
+	return a.Report(), nil
+}
+
+type pairKey struct {
+	currency, quote, source string
+}
+
+type pairState struct {
+	entity.PairQuality
+	last      *entity.Exchrate
+	runStart  time.Time
+	runLength int64
+}
+
+// Analyzer collects the issues of the rates within [from, till], which are added in the order of time per pair.
+type Analyzer struct {
+	cfg      Config
+	from     time.Time
+	till     time.Time
+	pairs    map[pairKey]*pairState
+	expected map[pairKey]bool
+}
+
+func NewAnalyzer(cfg Config, from, till time.Time) *Analyzer {
+	return &Analyzer{
+		cfg:      cfg,
+		from:     from,
+		till:     till,
+		pairs:    map[pairKey]*pairState{},
+		expected: map[pairKey]bool{},
+	}
+}
+
+func (a *Analyzer) pair(k pairKey) *pairState {
+	p, ok := a.pairs[k]
+	if !ok {
+		p = &pairState{PairQuality: entity.PairQuality{Currency: k.currency, Quote: k.quote, Source: k.source}}
+		a.pairs[k] = p
+	}
+	return p
+}
+
+func (a *Analyzer) Add(e entity.Exchrate) {
+	p := a.pair(pairKey{e.Currency, e.Quote, e.Source})
+	p.Rates++
+
+	prevTime := a.from
+	if p.last != nil {
+		prevTime = p.last.Time
+	}
+	a.checkGap(p, prevTime, e.Time, p.last == nil)
+
+	if p.last != nil {
+		if a.cfg.PollerInterval > 0 && e.Time.Sub(p.last.Time) < a.cfg.PollerInterval/2 {
+			p.Duplicates++
+		}
+		if !p.last.Rate.IsZero() {
+			change := e.Rate.Div(p.last.Rate).Sub(decimal.NewFromInt(1))
+			if change.Abs().GreaterThan(a.cfg.MaxJump) {
+				p.Jumps = append(p.Jumps, entity.Jump{Time: e.Time, From: p.last.Rate, To: e.Rate, Change: change.Round(6)})
+			}
+		}
+	}
+
+	if p.last != nil && p.last.Rate.Equal(e.Rate) {
+		p.runLength++
+	} else {
+		a.closeRun(p)
+		p.runStart, p.runLength = e.Time, 1
+	}
+	p.last = &e
+}
+
+// AddPolls counts the polls of a pair from a source.
+func (a *Analyzer) AddPolls(s entity.PollStat) {
+	p := a.pair(pairKey{s.Currency, s.Quote, s.Source})
+	p.Polls += s.Polls
+	p.PollErrors += s.Errors
+}
+
+// Expect makes the pair a part of the report even if it has no rates from any source.
+func (a *Analyzer) Expect(currency, quote string) {
+	a.expected[pairKey{currency: currency, quote: quote}] = true
+}
+
+// Report closes the open gaps and runs of the pairs and returns the report.
+func (a *Analyzer) Report() *entity.QualityReport {
+	seen := map[pairKey]bool{}
+	for k := range a.pairs {
+		seen[pairKey{currency: k.currency, quote: k.quote}] = true
+	}
+	for k := range a.expected {
+		if !seen[k] {
+			a.pair(k)
+		}
+	}
+
+	report := &entity.QualityReport{From: a.from, Till: a.till, Interval: a.cfg.PollerInterval.String()}
+	for _, p := range a.pairs {
+		if p.last == nil {
+			a.checkGap(p, a.from, a.till, true)
+		} else {
+			a.checkGap(p, p.last.Time, a.till, true)
+		}
+		a.closeRun(p)
+		if p.Polls > 0 {
+			p.ErrorRatio = float64(p.PollErrors) / float64(p.Polls)
+		}
+		report.Pairs = append(report.Pairs, p.PairQuality)
+	}
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		pi, pj := report.Pairs[i], report.Pairs[j]
+		if pi.Currency != pj.Currency {
+			return pi.Currency < pj.Currency
+		}
+		if pi.Quote != pj.Quote {
+			return pi.Quote < pj.Quote
+		}
+		return pi.Source < pj.Source
+	})
+	return report
+}
+
+// checkGap records a gap if more than the tolerance passed between from and till, which are the times of two rates
+// in a row or, if bound is set, a bound of the range and the time of a rate.
+func (a *Analyzer) checkGap(p *pairState, from, till time.Time, bound bool) {
+	interval := a.cfg.PollerInterval
+	if interval <= 0 || float64(till.Sub(from)) <= gapTolerance*float64(interval) {
+		return
+	}
+	missing := int64((till.Sub(from) + interval/2) / interval)
+	if !bound {
+		missing-- // the rate at till is not missing
+	}
+	if missing < 1 {
+		missing = 1
+	}
+	p.Gaps = append(p.Gaps, entity.Gap{From: from, Till: till, Missing: missing})
+}
+
+func (a *Analyzer) closeRun(p *pairState) {
+	if a.cfg.StaleCount > 0 && p.runLength >= int64(a.cfg.StaleCount) {
+		p.StaleRuns = append(p.StaleRuns, entity.StaleRun{From: p.runStart, Till: p.last.Time, Rate: p.last.Rate, Count: p.runLength})
+	}
+	p.runLength = 0
+}
@@ -0,0 +1,60 @@
+package quality
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+func TestAnalyzer(t *testing.T) {
+	t.Parallel()
+
+	from := time.Date(2020, 3, 10, 0, 0, 0, 0, time.UTC)
+	till := from.Add(20 * time.Minute)
+	a := NewAnalyzer(Config{PollerInterval: time.Minute, MaxJump: decimal.RequireFromString("0.05"), StaleCount: 3}, from, till)
+
+	add := func(minutes float64, rate string) {
+		a.Add(entity.Exchrate{
+			Time:     from.Add(time.Duration(minutes * float64(time.Minute))),
+			Currency: "USD",
+			Quote:    entity.DefaultQuote,
+			Source:   "test",
+			Rate:     decimal.RequireFromString(rate),
+		})
+	}
+	add(0, "75")
+	add(1, "75")
+	add(1.2, "75") // a duplicate
+	add(2, "76")
+	add(7, "76") // 4 missing before
+	add(8, "90") // a jump
+	add(9, "90.5")
+	add(17, "90.5") // 7 missing before, then 3 missing till the end
+	a.AddPolls(entity.PollStat{Currency: "USD", Quote: entity.DefaultQuote, Source: "test", Polls: 10, Errors: 2})
+	a.Expect("USD", entity.DefaultQuote)
+	a.Expect("EUR", entity.DefaultQuote)
+
+	report := a.Report()
+	require.Len(t, report.Pairs, 2)
+
+	eur := report.Pairs[0]
+	assert.Equal(t, "EUR", eur.Currency)
+	assert.Equal(t, []entity.Gap{{From: from, Till: till, Missing: 20}}, eur.Gaps)
+	assert.False(t, eur.Healthy())
+
+	usd := report.Pairs[1]
+	assert.Equal(t, int64(8), usd.Rates)
+	assert.Equal(t, int64(1), usd.Duplicates)
+	require.Len(t, usd.Gaps, 3)
+	assert.Equal(t, []int64{4, 7, 3}, []int64{usd.Gaps[0].Missing, usd.Gaps[1].Missing, usd.Gaps[2].Missing})
+	require.Len(t, usd.Jumps, 1)
+	assert.Equal(t, from.Add(8*time.Minute), usd.Jumps[0].Time)
+	require.Len(t, usd.StaleRuns, 1)
+	assert.Equal(t, int64(3), usd.StaleRuns[0].Count)
+	assert.Equal(t, 0.2, usd.ErrorRatio)
+}
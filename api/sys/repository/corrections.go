@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	qu "github.com/Masterminds/squirrel"
+	"github.com/pkg/errors"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+var ErrNotFound = errors.New("rate not found")
+
+// OverrideExchrate replaces the value of a rate, or adds the rate if it is not stored. Unlike a plain write,
+// the new version of the rate is recorded as an override along with the actor and the reason.
+func (r *RDBMSRepository) OverrideExchrate(ctx context.Context, c entity.Correction) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		if err := setChange(ctx, tx, entity.VersionOverride, c); err != nil {
+			return err
+		}
+
+		psql := qu.StatementBuilder.PlaceholderFormat(qu.Dollar)
+		query, args, err := psql.Insert("exchange_rate").Columns("time", "currency", "quote", "rate", "source").
+			Values(c.Time, c.Currency, c.Quote, c.Rate, c.Source).
+			Suffix(upsertExchrate).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		written, writtenArgs := writtenRates([]entity.Exchrate{c.Exchrate()})
+		return refreshRollups(ctx, tx, written, writtenArgs...)
+
+	}, sql.LevelReadCommitted)
+}
+
+// VoidExchrate removes a rate from the queries, while its versions are kept for the audit. ErrNotFound is
+// returned if the rate is not stored, which includes the rates already purged by the retention policy.
+func (r *RDBMSRepository) VoidExchrate(ctx context.Context, c entity.Correction) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		if err := setChange(ctx, tx, entity.VersionVoid, c); err != nil {
+			return err
+		}
+
+		var voided entity.Exchrate
+		err := tx.QueryRowContext(ctx, `DELETE FROM exchange_rate
+			WHERE time = $1 AND currency = $2 AND quote = $3 AND source = $4
+			RETURNING time, currency, quote, rate`, c.Time, c.Currency, c.Quote, c.Source).
+			Scan(&voided.Time, &voided.Currency, &voided.Quote, &voided.Rate)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		written, writtenArgs := writtenRates([]entity.Exchrate{voided})
+		return refreshRollups(ctx, tx, written, writtenArgs...)
+
+	}, sql.LevelReadCommitted)
+}
+
+// GetExchrateVersions returns the audit trail of a rate, from its first version to the current one.
+func (r *RDBMSRepository) GetExchrateVersions(ctx context.Context, key entity.Exchrate) ([]entity.RateVersion, error) {
+	var versions []entity.RateVersion
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT time, currency, quote, source, rate, kind, actor, reason, recorded_at, superseded_at
+			FROM `+versionsTable+`
+			WHERE time = $1 AND currency = $2 AND quote = $3 AND source = $4
+			ORDER BY recorded_at, id`, key.Time, key.Currency, key.Quote, key.Source)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		versions = nil
+		for rows.Next() {
+			var v entity.RateVersion
+			if err := rows.Scan(&v.Time, &v.Currency, &v.Quote, &v.Source, &v.Rate, &v.Kind, &v.Actor, &v.Reason,
+				&v.RecordedAt, &v.SupersededAt); err != nil {
+				return err
+			}
+			versions = append(versions, v)
+		}
+		return rows.Err()
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return nil, execErr
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	return versions, nil
+}
+
+// setChange tells the trigger recording the versions of the rates how to record the changes of the transaction
+func setChange(ctx context.Context, tx *sql.Tx, kind string, c entity.Correction) error {
+	_, err := tx.ExecContext(ctx, `SELECT set_config('exchrates.change_kind', $1, true),
+		set_config('exchrates.change_actor', $2, true), set_config('exchrates.change_reason', $3, true)`,
+		kind, c.Actor, c.Reason)
+	return errors.Wrap(err, "setting the change")
+}
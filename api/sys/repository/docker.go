@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -47,7 +48,11 @@ func NewDockerRepo() (*RDBMSRepository, func(), error) {
 		container.Shutdown()
 	}
 
-	if err := repo.MigrateUp(); err != nil {
+	if _, err := repo.MigrateUp(0); err != nil {
+		return nil, closer, err
+	}
+
+	if err := repo.Seed(context.Background()); err != nil {
 		return nil, closer, err
 	}
 
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// interpolationDigits are the digits after the point an interpolated average is computed with
+const interpolationDigits = 16
+
+// knownBucket is an interval of the history that has rates, n being its number based on localEpoch
+type knownBucket struct {
+	n    int64
+	rate decimal.Decimal
+}
+
+// filledHistory returns every interval of the page of the history, filling the ones without rates. The page
+// is counted in intervals rather than in intervals with rates, and the neighbouring intervals with rates just
+// outside of the page are read along, so that the page is filled the same as it would be as a part of the whole.
+func filledHistory(ctx context.Context, tx *sql.Tx, opts RatesQueryOpts, samples string, sampleArgs []interface{}) ([]entity.Average, error) {
+	loc := locationOrUTC(opts.Location)
+	first := bucketNumber(opts.From, opts.SecondsInInterval, loc) + int64(opts.Offset)
+	last := bucketNumber(opts.Till, opts.SecondsInInterval, loc)
+	if opts.Limit == 0 || first > last {
+		return []entity.Average{}, nil
+	}
+	if limited := first + int64(opts.Limit) - 1; limited < last {
+		last = limited
+	}
+
+	args := append([]interface{}{loc.String(), opts.SecondsInInterval}, sampleArgs...)
+	args = append(args, first, first, last, last)
+	rows, err := tx.QueryContext(ctx, dollarQuery("WITH h AS (SELECT n, avg(rate) AS rate "+
+		"FROM ("+sourceRates(samples, localEpoch+"/? AS n")+") p "+
+		"GROUP BY n) "+
+		"(SELECT n, rate FROM h WHERE n < ? ORDER BY n DESC LIMIT 1) "+
+		"UNION ALL (SELECT n, rate FROM h WHERE n >= ? AND n <= ?) "+
+		"UNION ALL (SELECT n, rate FROM h WHERE n > ? ORDER BY n LIMIT 1) "+
+		"ORDER BY n"),
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var known []knownBucket
+	for rows.Next() {
+		var b knownBucket
+		if err := rows.Scan(&b.n, &b.rate); err != nil {
+			return nil, err
+		}
+		known = append(known, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return fillBuckets(known, first, last, opts.SecondsInInterval, loc, opts.Fill), nil
+}
+
+// fillBuckets returns the intervals first to last, taking the averages of the known ones, which are ordered
+// by number and may include the closest ones outside of the range, and filling the others in the fill mode.
+// The intervals whose start does not exist on the wall clock of loc, as skipped by a DST change, are left out.
+func fillBuckets(known []knownBucket, first, last int64, secondsInInterval uint64, loc *time.Location, mode string) []entity.Average {
+	averages := make([]entity.Average, 0, last-first+1)
+	var prev *knownBucket
+	i := 0
+	for n := first; n <= last; n++ {
+		for i < len(known) && known[i].n < n {
+			prev = &known[i]
+			i++
+		}
+		start := bucketTime(n, secondsInInterval, loc)
+		if i < len(known) && known[i].n == n {
+			averages = append(averages, entity.Average{Time: start, Rate: decimal.NewNullDecimal(known[i].rate)})
+			continue
+		}
+		if bucketNumber(start, secondsInInterval, loc) != n {
+			continue
+		}
+
+		a := entity.Average{Time: start, Filled: true}
+		switch {
+		case mode == entity.FillPrevious && prev != nil:
+			a.Rate = decimal.NewNullDecimal(prev.rate)
+		case mode == entity.FillLinear && prev != nil && i < len(known):
+			next := known[i]
+			t0 := bucketTime(prev.n, secondsInInterval, loc).Unix()
+			t1 := bucketTime(next.n, secondsInInterval, loc).Unix()
+			share := decimal.NewFromInt(start.Unix()-t0).DivRound(decimal.NewFromInt(t1-t0), interpolationDigits)
+			a.Rate = decimal.NewNullDecimal(prev.rate.Add(next.rate.Sub(prev.rate).Mul(share)))
+		}
+		averages = append(averages, a)
+	}
+	return averages
+}
+
+// bucketNumber returns the number of the interval based on localEpoch that has t
+func bucketNumber(t time.Time, secondsInInterval uint64, loc *time.Location) int64 {
+	w := t.In(loc)
+	wall := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, time.UTC)
+	return wall.Unix() / int64(secondsInInterval)
+}
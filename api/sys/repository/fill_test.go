@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+func TestFillBuckets(t *testing.T) {
+	t.Parallel()
+
+	// hours 9 to 13 of a day with the rates at 8 (before the page), 10 and 14 (after the page)
+	start := time.Date(2020, 3, 10, 9, 0, 0, 0, time.UTC)
+	first := bucketNumber(start, 3600, time.UTC)
+	known := []knownBucket{
+		{n: first - 1, rate: decimal.RequireFromString("70")},
+		{n: first + 1, rate: decimal.RequireFromString("72")},
+		{n: first + 5, rate: decimal.RequireFromString("80")},
+	}
+
+	for mode, expected := range map[string][]string{
+		entity.FillNull:     {"", "72", "", "", ""},
+		entity.FillPrevious: {"70", "72", "72", "72", "72"},
+		entity.FillLinear:   {"71", "72", "74", "76", "78"},
+	} {
+		averages := fillBuckets(known, first, first+4, 3600, time.UTC, mode)
+		require.Len(t, averages, 5, mode)
+		for i, a := range averages {
+			assert.Equal(t, start.Add(time.Duration(i)*time.Hour), a.Time, mode)
+			assert.Equal(t, i != 1, a.Filled, mode)
+			if expected[i] == "" {
+				assert.False(t, a.Rate.Valid, "%s at %d", mode, i)
+				continue
+			}
+			require.True(t, a.Rate.Valid, "%s at %d", mode, i)
+			assert.True(t, decimal.RequireFromString(expected[i]).Equal(a.Rate.Decimal), "%s at %d: %s", mode, i, a.Rate.Decimal)
+		}
+	}
+
+	t.Run("nothing to fill from", func(t *testing.T) {
+		averages := fillBuckets(nil, first, first+1, 3600, time.UTC, entity.FillLinear)
+		require.Len(t, averages, 2)
+		assert.False(t, averages[0].Rate.Valid)
+		assert.True(t, averages[0].Filled)
+	})
+
+	t.Run("hour skipped by DST", func(t *testing.T) {
+		loc, err := time.LoadLocation("Europe/Berlin")
+		require.NoError(t, err)
+		// clocks went from 02:00 to 03:00 on 2020-03-29
+		n := bucketNumber(time.Date(2020, 3, 29, 1, 0, 0, 0, loc), 3600, loc)
+		averages := fillBuckets(nil, n, n+2, 3600, loc, entity.FillNull)
+		require.Len(t, averages, 2)
+		assert.Equal(t, 1, averages[0].Time.Hour())
+		assert.Equal(t, 3, averages[1].Time.Hour())
+	})
+}
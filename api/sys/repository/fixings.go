@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// GetFixingSample returns the sum and the count of the rates a fixing is made from: the rates of every source
+// at the last time within the window before the cut-off, so that the sources are averaged the same as by
+// GetMomental, or all of the rates of the window for an average.
+func (r *RDBMSRepository) GetFixingSample(ctx context.Context, spec entity.FixingSpec, cutoff time.Time) (decimal.Decimal, int64, error) {
+	var sum decimal.Decimal
+	var count int64
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		query := `SELECT COALESCE(sum(rate), 0), count(*) FROM exchange_rate
+			WHERE currency = $1 AND quote = $2 AND time <= $3 AND time > $4`
+		if spec.Method == entity.FixingLast {
+			query = `SELECT COALESCE(sum(rate), 0), count(*) FROM exchange_rate
+				WHERE currency = $1 AND quote = $2 AND time = (SELECT max(time) FROM exchange_rate
+					WHERE currency = $1 AND quote = $2 AND time <= $3 AND time > $4)`
+		}
+		return tx.QueryRowContext(ctx, query, spec.Currency, spec.Quote, cutoff, cutoff.Add(-spec.Window)).Scan(&sum, &count)
+
+	}, sql.LevelRepeatableRead)
+
+	if execErr != nil {
+		return decimal.Zero, 0, execErr
+	}
+	return sum, count, nil
+}
+
+// AddFixing stores the fixing unless the pair is already fixed for the day, since fixings never change.
+// It tells whether the fixing was stored.
+func (r *RDBMSRepository) AddFixing(ctx context.Context, f entity.Fixing) (bool, error) {
+	var added bool
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `INSERT INTO exchange_rate_fixing
+			(date, currency, quote, cutoff, method, window_seconds, rate, samples)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (date, currency, quote) DO NOTHING`,
+			f.Date, f.Currency, f.Quote, f.Cutoff, f.Method, f.WindowSeconds, f.Rate, f.Samples)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		added = n > 0
+		return err
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return false, execErr
+	}
+	return added, nil
+}
+
+// GetFixings returns the fixings of the day, given as '2006-01-02'.
+func (r *RDBMSRepository) GetFixings(ctx context.Context, date string) ([]entity.Fixing, error) {
+	var fixings []entity.Fixing
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT date, currency, quote, cutoff, method, window_seconds, rate, samples, created_at
+			FROM exchange_rate_fixing
+			WHERE date = $1
+			ORDER BY currency, quote`, date)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		fixings = nil
+		for rows.Next() {
+			var f entity.Fixing
+			var day time.Time
+			if err := rows.Scan(&day, &f.Currency, &f.Quote, &f.Cutoff, &f.Method, &f.WindowSeconds, &f.Rate, &f.Samples,
+				&f.CreatedAt); err != nil {
+				return err
+			}
+			f.Date = day.Format(entity.DateFormat)
+			fixings = append(fixings, f)
+		}
+		return rows.Err()
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return nil, execErr
+	}
+	return fixings, nil
+}
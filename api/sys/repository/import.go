@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"io"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+var ErrConflict = errors.New("some rates already exist")
+
+type ImportRow struct {
+	Line     int
+	Exchrate entity.Exchrate
+}
+
+type ImportResult struct {
+	Inserted int
+	Updated  int
+	Rejected []entity.RejectedRow
+}
+
+// ImportExchrates copies the batches returned by next into a staging table and then moves them into
+// exchange_rate in one transaction, resolving the rates that already exist according to the conflict mode.
+// next must return io.EOF once there are no more rows. In the 'error' mode nothing is stored if there are
+// conflicts, and ErrConflict is returned along with the conflicting rows.
+func (r *RDBMSRepository) ImportExchrates(ctx context.Context, mode string, next func() ([]ImportRow, error)) (ImportResult, error) {
+	var res ImportResult
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		res = ImportResult{}
+
+		if _, err := tx.ExecContext(ctx, `CREATE TEMP TABLE exchange_rate_import
+			(
+			  line INT NOT NULL,
+			  time TIMESTAMPTZ NOT NULL,
+			  currency VARCHAR(3) NOT NULL,
+			  quote VARCHAR(3) NOT NULL,
+			  rate NUMERIC NOT NULL,
+			  source VARCHAR(64) NOT NULL
+			) ON COMMIT DROP;`); err != nil {
+			return err
+		}
+
+		for {
+			rows, err := next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := copyImportRows(ctx, tx, rows); err != nil {
+				return errors.Wrap(err, "copying rows")
+			}
+		}
+
+		dups, err := rejectImportRows(ctx, tx, `DELETE FROM exchange_rate_import i
+			USING (SELECT line, first_value(line) OVER (PARTITION BY time, currency, quote, source ORDER BY line) AS first_line
+				FROM exchange_rate_import) d
+			WHERE i.line = d.line AND d.line <> d.first_line
+			RETURNING i.line, 'duplicate of line ' || d.first_line`)
+		if err != nil {
+			return errors.Wrap(err, "removing duplicates")
+		}
+		res.Rejected = append(res.Rejected, dups...)
+
+		insert := `INSERT INTO exchange_rate (time, currency, quote, rate, source)
+			SELECT time, currency, quote, rate, source FROM exchange_rate_import ORDER BY line `
+		switch mode {
+		case entity.ConflictError:
+			conflicts, err := rejectImportRows(ctx, tx, `SELECT line, 'rate already exists' FROM exchange_rate_import i
+				WHERE EXISTS (SELECT 1 FROM exchange_rate e
+					WHERE e.time = i.time AND e.currency = i.currency AND e.quote = i.quote AND e.source = i.source)
+				ORDER BY line`)
+			if err != nil {
+				return errors.Wrap(err, "finding conflicts")
+			}
+			if len(conflicts) > 0 {
+				res.Rejected = append(res.Rejected, conflicts...)
+				return ErrConflict
+			}
+			inserted, err := tx.ExecContext(ctx, insert)
+			if err != nil {
+				return errors.Wrap(err, "inserting rates")
+			}
+			n, _ := inserted.RowsAffected()
+			res.Inserted = int(n)
+		case entity.ConflictSkip:
+			conflicts, err := rejectImportRows(ctx, tx, `WITH inserted AS (`+insert+`
+					ON CONFLICT (time, currency, quote, source) DO NOTHING
+					RETURNING time, currency, quote, source)
+				SELECT line, 'rate already exists' FROM exchange_rate_import i
+				WHERE NOT EXISTS (SELECT 1 FROM inserted e
+					WHERE e.time = i.time AND e.currency = i.currency AND e.quote = i.quote AND e.source = i.source)
+				ORDER BY line`)
+			if err != nil {
+				return errors.Wrap(err, "inserting rates")
+			}
+			var total int
+			if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM exchange_rate_import").Scan(&total); err != nil {
+				return err
+			}
+			res.Inserted = total - len(conflicts)
+			res.Rejected = append(res.Rejected, conflicts...)
+
+			// the skipped rates are not written, so they must not be rolled up
+			lines := make([]int64, len(conflicts))
+			for i, c := range conflicts {
+				lines[i] = int64(c.Line)
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM exchange_rate_import WHERE line = ANY($1)", pq.Array(lines)); err != nil {
+				return err
+			}
+		case entity.ConflictOverwrite:
+			err := tx.QueryRowContext(ctx, `WITH upserted AS (`+insert+upsertExchrate+`
+					RETURNING xmax = 0 AS is_new)
+				SELECT count(*) FILTER (WHERE is_new), count(*) FILTER (WHERE NOT is_new) FROM upserted`).
+				Scan(&res.Inserted, &res.Updated)
+			if err != nil {
+				return errors.Wrap(err, "inserting rates")
+			}
+		default:
+			return errors.Errorf("unsupported conflict mode '%s'", mode)
+		}
+
+		return refreshRollups(ctx, tx, "SELECT time, currency, quote, source, rate FROM exchange_rate_import")
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		if execErr == ErrConflict {
+			return res, execErr
+		}
+		return ImportResult{}, execErr
+	}
+	return res, nil
+}
+
+func copyImportRows(ctx context.Context, tx *sql.Tx, rows []ImportRow) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("exchange_rate_import", "line", "time", "currency", "quote", "rate", "source"))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		e := row.Exchrate
+		if _, err := stmt.ExecContext(ctx, row.Line, e.Time, e.Currency, e.Quote, e.Rate, e.Source); err != nil {
+			_ = stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		_ = stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
+
+func rejectImportRows(ctx context.Context, tx *sql.Tx, query string) ([]entity.RejectedRow, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rejected []entity.RejectedRow
+	for rows.Next() {
+		var rr entity.RejectedRow
+		if err := rows.Scan(&rr.Line, &rr.Reason); err != nil {
+			return nil, err
+		}
+		rejected = append(rejected, rr)
+	}
+	return rejected, rows.Err()
+}
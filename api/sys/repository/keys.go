@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+var ErrDuplicateName = errors.New("name already taken")
+
+// AddAPIKey stores the key by its hash and returns it with its id. ErrDuplicateName is returned if the name
+// is taken by another key, including a revoked one.
+func (r *RDBMSRepository) AddAPIKey(ctx context.Context, k entity.APIKey, hash string) (entity.APIKey, error) {
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `INSERT INTO exchange_rate_api_key (name, role, prefix, hash)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (name) DO NOTHING
+			RETURNING id, created_at`, k.Name, k.Role, k.Prefix, hash).Scan(&k.ID, &k.CreatedAt)
+		if err == sql.ErrNoRows {
+			return ErrDuplicateName
+		}
+		return err
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return entity.APIKey{}, execErr
+	}
+	return k, nil
+}
+
+// GetAPIKeys returns all of the keys, the revoked ones included.
+func (r *RDBMSRepository) GetAPIKeys(ctx context.Context) ([]entity.APIKey, error) {
+	var keys []entity.APIKey
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT id, name, role, prefix, created_at, revoked_at
+			FROM exchange_rate_api_key
+			ORDER BY id`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		keys = []entity.APIKey{}
+		for rows.Next() {
+			var k entity.APIKey
+			if err := rows.Scan(&k.ID, &k.Name, &k.Role, &k.Prefix, &k.CreatedAt, &k.RevokedAt); err != nil {
+				return err
+			}
+			keys = append(keys, k)
+		}
+		return rows.Err()
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return nil, execErr
+	}
+	return keys, nil
+}
+
+// GetAPIKeyByHash returns the key with the hash unless it is revoked, or ErrNotFound.
+func (r *RDBMSRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*entity.APIKey, error) {
+	var k entity.APIKey
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `SELECT id, name, role, prefix, created_at
+			FROM exchange_rate_api_key
+			WHERE hash = $1 AND revoked_at IS NULL`, hash).Scan(&k.ID, &k.Name, &k.Role, &k.Prefix, &k.CreatedAt)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return nil, execErr
+	}
+	return &k, nil
+}
+
+// RevokeAPIKey stops the key from authenticating. ErrNotFound is returned if there is no such key in use.
+func (r *RDBMSRepository) RevokeAPIKey(ctx context.Context, id int64) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `UPDATE exchange_rate_api_key SET revoked_at = now()
+			WHERE id = $1 AND revoked_at IS NULL`, id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+
+	}, sql.LevelReadCommitted)
+}
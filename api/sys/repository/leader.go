@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// AdvisoryLock is a session advisory lock, held on a connection of its own. Postgres releases it once
+// the connection is gone, so a replica that dies or loses the db loses the lock as well.
+type AdvisoryLock struct {
+	key  int64
+	conn *sql.Conn
+}
+
+// TryAdvisoryLock takes the advisory lock of the key unless another session holds it, returning nil then.
+func (r *RDBMSRepository) TryAdvisoryLock(ctx context.Context, key int64) (*AdvisoryLock, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting a connection for the lock")
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "taking advisory lock %d", key)
+	}
+	if !locked {
+		conn.Close()
+		return nil, nil
+	}
+	return &AdvisoryLock{key: key, conn: conn}, nil
+}
+
+// Check tells whether the lock is still held, i.e. whether its connection is still there.
+func (l *AdvisoryLock) Check(ctx context.Context) error {
+	var held bool
+	err := l.conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_locks
+		WHERE locktype = 'advisory' AND pid = pg_backend_pid() AND granted
+			AND ((classid::bigint << 32) | objid::bigint) = $1 AND objsubid = 1)`, l.key).Scan(&held)
+	if err != nil {
+		return errors.Wrapf(err, "checking advisory lock %d", l.key)
+	}
+	if !held {
+		return errors.Errorf("advisory lock %d is not held", l.key)
+	}
+	return nil
+}
+
+// Release releases the lock and the connection it is held on.
+func (l *AdvisoryLock) Release(ctx context.Context) error {
+	defer l.conn.Close()
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		return errors.Wrapf(err, "releasing advisory lock %d", l.key)
+	}
+	return nil
+}
+
+// PollerWanted tells whether the poller of the replicas electing their leader by the key is meant to run.
+// It is not until it is started.
+func (r *RDBMSRepository) PollerWanted(ctx context.Context, key int64) (bool, error) {
+	var wanted bool
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "SELECT wanted FROM exchange_rate_poller_intent WHERE lock_key = $1", key).Scan(&wanted)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return false, execErr
+	}
+	return wanted, nil
+}
+
+// SetPollerWanted keeps whether the poller of the replicas electing their leader by the key is meant to run.
+func (r *RDBMSRepository) SetPollerWanted(ctx context.Context, key int64, wanted bool) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO exchange_rate_poller_intent (lock_key, wanted) VALUES ($1, $2)
+			ON CONFLICT (lock_key) DO UPDATE SET wanted = EXCLUDED.wanted, updated_at = now()`, key, wanted)
+		return err
+
+	}, sql.LevelReadCommitted)
+}
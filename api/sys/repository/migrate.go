@@ -1,64 +1,164 @@
 package repository
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 	migrate "github.com/rubenv/sql-migrate"
 )
 
-var migrations = &migrate.MemoryMigrationSource{
-	Migrations: []*migrate.Migration{
-		{
-			Id: "00001_initial_migration",
-			Up: []string{
-				`CREATE TABLE exchange_rate
-					(
-					  id SERIAL PRIMARY KEY,
-					  time TIMESTAMP NOT NULL,
-					  currency VARCHAR(3) NOT NULL,
-					  rate NUMERIC NOT NULL,
-					  created_at TIMESTAMP NOT NULL default NOW()
-					);`,
-
-				"CREATE INDEX exchange_rate_idx ON exchange_rate (time,currency);",
-
-				`INSERT INTO exchange_rate (time, currency, rate)
-					VALUES 
-						('2020-03-10 15:07:30'::timestamp,'USD', 79.38426),
-						('2020-03-10 16:07:30'::timestamp,'USD', 79.4),
-						('2020-03-10 17:07:30'::timestamp,'USD', 79.58426),
-						('2020-03-10 18:07:30'::timestamp,'USD', 79.48426),
-
-						('2020-03-15 15:07:30'::timestamp,'USD', 77.38426),
-						('2020-03-15 16:07:30'::timestamp,'USD', 77.4),
-						('2020-03-15 17:07:30'::timestamp,'USD', 77.58426),
-						('2020-03-15 18:07:30'::timestamp,'USD', 77.48426),
-
-						('2020-03-20 15:07:30'::timestamp,'USD', 66.7),
-						('2020-03-20 15:07:00'::timestamp,'USD', 66.78888),
-						('2020-03-20 15:08:00'::timestamp,'USD', 67.8),
-						('2020-03-20 15:08:30'::timestamp,'USD', 67.89999),
-						('2020-03-20 15:09:00'::timestamp,'USD', 68.9),
-
-						('2020-03-21 17:17:30'::timestamp,'EUR', 86.7),
-						('2020-03-21 17:17:00'::timestamp,'EUR', 86.78888),
-						('2020-03-21 17:18:00'::timestamp,'EUR', 87.8),
-						('2020-03-21 17:18:30'::timestamp,'EUR', 87.89999),
-						('2020-03-21 17:19:00'::timestamp,'EUR', 88.9)
-					;`,
-			},
-			Down: []string{
-				"DROP INDEX IF EXISTS exchange_rate_idx;",
-				"DROP TABLE IF EXISTS exchange_rate;",
-			},
-		},
-	},
+// Migrations and seeds are kept per dialect in migrations/<driver> and seeds/<driver>.
+// Migration ids are the file names without the extension.
+//
+//go:embed migrations seeds
+var sqlFiles embed.FS
+
+type MigrationStatus struct {
+	ID        string     `json:"id"`
+	AppliedAt *time.Time `json:"appliedAt"`
 }
 
-func (r *RDBMSRepository) MigrateUp() error {
-	_, err := migrate.Exec(r.db, r.Cfg.Driver, migrations, migrate.Up)
-	return err
+type embeddedMigrations struct {
+	dialect string
+}
+
+func (m embeddedMigrations) FindMigrations() ([]*migrate.Migration, error) {
+	dir := path.Join("migrations", m.dialect)
+	entries, err := sqlFiles.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Errorf("no migrations for the '%s' dialect", m.dialect)
+	}
+
+	var migrations []*migrate.Migration
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		data, err := sqlFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mig, err := migrate.ParseMigration(strings.TrimSuffix(entry.Name(), ".sql"), bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing migration %s", entry.Name())
+		}
+		migrations = append(migrations, mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Less(migrations[j]) })
+	return migrations, nil
+}
+
+// checkDialect fails for the drivers that have no migrations, which the queries are not written for either.
+func checkDialect(driver string) error {
+	supported := dialects()
+	for _, d := range supported {
+		if d == driver {
+			return nil
+		}
+	}
+	return errors.Errorf("unsupported repository driver '%s', the supported ones are: %s", driver, strings.Join(supported, ", "))
+}
+
+// dialects returns the dialects that have migrations.
+func dialects() []string {
+	entries, _ := sqlFiles.ReadDir("migrations")
+	var res []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			res = append(res, entry.Name())
+		}
+	}
+	return res
+}
+
+func (r *RDBMSRepository) migrations() migrate.MigrationSource {
+	return embeddedMigrations{dialect: r.Cfg.Driver}
 }
 
-func (r *RDBMSRepository) MigrateDown() error {
-	_, err := migrate.Exec(r.db, r.Cfg.Driver, migrations, migrate.Down)
+// MigrateUp applies at most max pending migrations, all of them if max is 0.
+func (r *RDBMSRepository) MigrateUp(max int) (int, error) {
+	return migrate.ExecMax(r.db, r.Cfg.Driver, r.migrations(), migrate.Up, max)
+}
+
+// MigrateDown rolls back the last max applied migrations.
+func (r *RDBMSRepository) MigrateDown(max int) (int, error) {
+	if max <= 0 {
+		return 0, errors.New("the number of migrations to roll back should be positive")
+	}
+	return migrate.ExecMax(r.db, r.Cfg.Driver, r.migrations(), migrate.Down, max)
+}
+
+// MigrateRedo rolls back the last applied migration and applies it again.
+func (r *RDBMSRepository) MigrateRedo() error {
+	n, err := r.MigrateDown(1)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("no migration to redo")
+	}
+	_, err = r.MigrateUp(1)
 	return err
 }
+
+// MigrateStatus lists the known migrations with the time they were applied, if they were.
+func (r *RDBMSRepository) MigrateStatus() ([]MigrationStatus, error) {
+	known, err := r.migrations().FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+	records, err := migrate.GetMigrationRecords(r.db, r.Cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]time.Time, len(records))
+	for _, rec := range records {
+		applied[rec.Id] = rec.AppliedAt
+	}
+
+	res := make([]MigrationStatus, 0, len(known))
+	for _, m := range known {
+		st := MigrationStatus{ID: m.Id}
+		if t, ok := applied[m.Id]; ok {
+			st.AppliedAt = &t
+		}
+		res = append(res, st)
+	}
+	return res, nil
+}
+
+// Seed loads the demo data. The seeds do not overwrite existing rates, so seeding twice is harmless.
+// The running replicas drop their cached reads once it commits, on the notification of the written rates.
+func (r *RDBMSRepository) Seed(ctx context.Context) error {
+	dir := path.Join("seeds", r.Cfg.Driver)
+	entries, err := sqlFiles.ReadDir(dir)
+	if err != nil {
+		return errors.Errorf("no seeds for the '%s' dialect", r.Cfg.Driver)
+	}
+
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+				continue
+			}
+			data, err := sqlFiles.ReadFile(path.Join(dir, entry.Name()))
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, string(data)); err != nil {
+				return errors.Wrapf(err, "applying seed %s", entry.Name())
+			}
+		}
+
+		// the seeds write the rates directly, and the rates written by this transaction are created at now()
+		return refreshRollups(ctx, tx, "SELECT time, currency, quote, source, rate FROM exchange_rate WHERE created_at = now()")
+
+	}, sql.LevelReadCommitted)
+}
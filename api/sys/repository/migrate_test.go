@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := embeddedMigrations{dialect: "postgres"}.FindMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	assert.Equal(t, "00001_initial_migration", migrations[0].Id)
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Up, m.Id)
+		assert.NotEmpty(t, m.Down, m.Id)
+		if i > 0 {
+			assert.True(t, migrations[i-1].Less(m), m.Id)
+		}
+	}
+
+	_, err = embeddedMigrations{dialect: "mssql"}.FindMigrations()
+	assert.Error(t, err)
+}
+
+func TestCheckDialect(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, checkDialect("postgres"))
+	assert.EqualError(t, checkDialect("mysql"), "unsupported repository driver 'mysql', the supported ones are: postgres")
+	assert.Error(t, checkDialect(""))
+}
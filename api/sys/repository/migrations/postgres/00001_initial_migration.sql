@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE exchange_rate
+(
+  id SERIAL PRIMARY KEY,
+  time TIMESTAMP NOT NULL,
+  currency VARCHAR(3) NOT NULL,
+  rate NUMERIC NOT NULL,
+  created_at TIMESTAMP NOT NULL default NOW()
+);
+
+CREATE INDEX exchange_rate_idx ON exchange_rate (time,currency);
+
+-- +migrate Down
+DROP INDEX IF EXISTS exchange_rate_idx;
+DROP TABLE IF EXISTS exchange_rate;
@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE exchange_rate
+  ADD COLUMN quote VARCHAR(3) NOT NULL DEFAULT 'RUB',
+  ADD COLUMN source VARCHAR(64) NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE exchange_rate
+  DROP COLUMN IF EXISTS source,
+  DROP COLUMN IF EXISTS quote;
@@ -0,0 +1,20 @@
+-- +migrate Up
+-- duplicates are kept aside rather than deleted, only the latest written row of each key stays
+CREATE TABLE exchange_rate_duplicate AS
+  SELECT * FROM exchange_rate e
+  WHERE EXISTS (SELECT 1 FROM exchange_rate d
+    WHERE d.time = e.time AND d.currency = e.currency AND d.quote = e.quote AND d.source = e.source
+      AND d.id > e.id);
+
+DELETE FROM exchange_rate WHERE id IN (SELECT id FROM exchange_rate_duplicate);
+
+DROP INDEX IF EXISTS exchange_rate_idx;
+
+ALTER TABLE exchange_rate
+  ADD CONSTRAINT exchange_rate_natural_key UNIQUE (time, currency, quote, source);
+
+-- +migrate Down
+ALTER TABLE exchange_rate DROP CONSTRAINT IF EXISTS exchange_rate_natural_key;
+CREATE INDEX exchange_rate_idx ON exchange_rate (time,currency);
+INSERT INTO exchange_rate SELECT * FROM exchange_rate_duplicate;
+DROP TABLE IF EXISTS exchange_rate_duplicate;
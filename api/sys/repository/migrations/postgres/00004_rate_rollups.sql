@@ -0,0 +1,47 @@
+-- +migrate Up
+-- the rollups are kept per source, so that the reads can average the sources evenly rather than by their number of rates
+CREATE TABLE exchange_rate_rollup
+(
+  resolution INT NOT NULL,
+  bucket TIMESTAMP NOT NULL,
+  currency VARCHAR(3) NOT NULL,
+  quote VARCHAR(3) NOT NULL,
+  source VARCHAR(64) NOT NULL,
+  count BIGINT NOT NULL,
+  sum NUMERIC NOT NULL,
+  min NUMERIC NOT NULL,
+  max NUMERIC NOT NULL,
+  PRIMARY KEY (resolution, currency, quote, source, bucket)
+);
+
+-- resolution 0 stands for the raw rates. Everything before purged_before is purged from the tier.
+CREATE TABLE exchange_rate_rollup_state
+(
+  resolution INT PRIMARY KEY,
+  purged_before TIMESTAMP
+);
+
+INSERT INTO exchange_rate_rollup_state (resolution) VALUES (0), (60), (3600);
+
+-- +migrate StatementBegin
+CREATE FUNCTION exchrate_ceil(ts TIMESTAMP, unit TEXT) RETURNS TIMESTAMP AS $$
+  SELECT CASE WHEN date_trunc(unit, ts) = ts THEN ts ELSE date_trunc(unit, ts) + ('1 ' || unit)::INTERVAL END
+$$ LANGUAGE SQL IMMUTABLE;
+-- +migrate StatementEnd
+
+-- the rollups are refreshed on every write from now on, so the rates already stored are rolled up once here
+INSERT INTO exchange_rate_rollup (resolution, bucket, currency, quote, source, count, sum, min, max)
+SELECT 60, date_trunc('minute', time), currency, quote, source, count(*), sum(rate), min(rate), max(rate)
+FROM exchange_rate
+GROUP BY 2, 3, 4, 5;
+
+INSERT INTO exchange_rate_rollup (resolution, bucket, currency, quote, source, count, sum, min, max)
+SELECT 3600, date_trunc('hour', bucket), currency, quote, source, sum(count), sum(sum), min(min), max(max)
+FROM exchange_rate_rollup
+WHERE resolution = 60
+GROUP BY 2, 3, 4, 5;
+
+-- +migrate Down
+DROP FUNCTION IF EXISTS exchrate_ceil(TIMESTAMP, TEXT);
+DROP TABLE IF EXISTS exchange_rate_rollup_state;
+DROP TABLE IF EXISTS exchange_rate_rollup;
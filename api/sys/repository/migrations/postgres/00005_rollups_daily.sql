@@ -0,0 +1,13 @@
+-- +migrate Up
+-- the daily rollups are refreshed on every write from now on, so they are computed once here from the hourly ones
+INSERT INTO exchange_rate_rollup_state (resolution) VALUES (86400);
+
+INSERT INTO exchange_rate_rollup (resolution, bucket, currency, quote, source, count, sum, min, max)
+SELECT 86400, date_trunc('day', bucket), currency, quote, source, sum(count), sum(sum), min(min), max(max)
+FROM exchange_rate_rollup
+WHERE resolution = 3600
+GROUP BY 2, 3, 4, 5;
+
+-- +migrate Down
+DELETE FROM exchange_rate_rollup WHERE resolution = 86400;
+DELETE FROM exchange_rate_rollup_state WHERE resolution = 86400;
@@ -0,0 +1,57 @@
+-- +migrate Up
+-- the rates were written as UTC wall clock, while created_at was filled by now() in the time zone of the server
+ALTER TABLE exchange_rate
+  ALTER COLUMN time TYPE TIMESTAMPTZ USING time AT TIME ZONE 'UTC',
+  ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE exchange_rate ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE exchange_rate_duplicate
+  ALTER COLUMN time TYPE TIMESTAMPTZ USING time AT TIME ZONE 'UTC',
+  ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+
+ALTER TABLE exchange_rate_rollup
+  ALTER COLUMN bucket TYPE TIMESTAMPTZ USING bucket AT TIME ZONE 'UTC';
+
+ALTER TABLE exchange_rate_rollup_state
+  ALTER COLUMN purged_before TYPE TIMESTAMPTZ USING purged_before AT TIME ZONE 'UTC';
+
+DROP FUNCTION IF EXISTS exchrate_ceil(TIMESTAMP, TEXT);
+
+-- the rollup buckets are aligned in UTC, whatever the time zone of the session is
+-- +migrate StatementBegin
+CREATE FUNCTION exchrate_trunc(unit TEXT, ts TIMESTAMPTZ) RETURNS TIMESTAMPTZ AS $$
+  SELECT date_trunc(unit, ts AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+$$ LANGUAGE SQL IMMUTABLE;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE FUNCTION exchrate_ceil(ts TIMESTAMPTZ, unit TEXT) RETURNS TIMESTAMPTZ AS $$
+  SELECT (CASE WHEN date_trunc(unit, t) = t THEN t ELSE date_trunc(unit, t) + ('1 ' || unit)::INTERVAL END) AT TIME ZONE 'UTC'
+  FROM (SELECT ts AT TIME ZONE 'UTC' AS t) u
+$$ LANGUAGE SQL IMMUTABLE;
+-- +migrate StatementEnd
+
+-- +migrate Down
+DROP FUNCTION IF EXISTS exchrate_ceil(TIMESTAMPTZ, TEXT);
+DROP FUNCTION IF EXISTS exchrate_trunc(TEXT, TIMESTAMPTZ);
+
+-- +migrate StatementBegin
+CREATE FUNCTION exchrate_ceil(ts TIMESTAMP, unit TEXT) RETURNS TIMESTAMP AS $$
+  SELECT CASE WHEN date_trunc(unit, ts) = ts THEN ts ELSE date_trunc(unit, ts) + ('1 ' || unit)::INTERVAL END
+$$ LANGUAGE SQL IMMUTABLE;
+-- +migrate StatementEnd
+
+ALTER TABLE exchange_rate_rollup_state
+  ALTER COLUMN purged_before TYPE TIMESTAMP USING purged_before AT TIME ZONE 'UTC';
+
+ALTER TABLE exchange_rate_rollup
+  ALTER COLUMN bucket TYPE TIMESTAMP USING bucket AT TIME ZONE 'UTC';
+
+ALTER TABLE exchange_rate_duplicate
+  ALTER COLUMN time TYPE TIMESTAMP USING time AT TIME ZONE 'UTC',
+  ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE current_setting('TimeZone');
+
+ALTER TABLE exchange_rate
+  ALTER COLUMN time TYPE TIMESTAMP USING time AT TIME ZONE 'UTC',
+  ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE exchange_rate ALTER COLUMN created_at SET DEFAULT now();
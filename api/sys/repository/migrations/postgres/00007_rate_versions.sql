@@ -0,0 +1,51 @@
+-- +migrate Up
+-- every value a rate ever had, with the time it was recorded and the time it was superseded at,
+-- so that the rates can be read as they were known at a past moment
+CREATE TABLE exchange_rate_version
+(
+  id BIGSERIAL PRIMARY KEY,
+  time TIMESTAMPTZ NOT NULL,
+  currency VARCHAR(3) NOT NULL,
+  quote VARCHAR(3) NOT NULL,
+  source VARCHAR(64) NOT NULL,
+  rate NUMERIC NOT NULL,
+  recorded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  superseded_at TIMESTAMPTZ
+);
+
+CREATE INDEX exchange_rate_version_idx ON exchange_rate_version (currency, time);
+CREATE UNIQUE INDEX exchange_rate_version_current_idx ON exchange_rate_version (time, currency, quote, source)
+  WHERE superseded_at IS NULL;
+
+-- the former overwrites are lost, so the stored rates are taken as known since they were created
+INSERT INTO exchange_rate_version (time, currency, quote, source, rate, recorded_at)
+SELECT time, currency, quote, source, rate, created_at FROM exchange_rate;
+
+-- the versions are recorded at the start of the writing transaction, like created_at.
+-- the purges of the retention policy delete the versions along with the rates.
+-- +migrate StatementBegin
+CREATE FUNCTION exchrate_record_version() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'UPDATE' THEN
+    UPDATE exchange_rate_version SET superseded_at = now()
+    WHERE time = OLD.time AND currency = OLD.currency AND quote = OLD.quote AND source = OLD.source
+      AND superseded_at IS NULL;
+  END IF;
+  INSERT INTO exchange_rate_version (time, currency, quote, source, rate, recorded_at)
+  VALUES (NEW.time, NEW.currency, NEW.quote, NEW.source, NEW.rate, now());
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER exchange_rate_version_insert AFTER INSERT ON exchange_rate
+  FOR EACH ROW EXECUTE PROCEDURE exchrate_record_version();
+
+CREATE TRIGGER exchange_rate_version_update AFTER UPDATE ON exchange_rate
+  FOR EACH ROW WHEN (OLD.rate IS DISTINCT FROM NEW.rate) EXECUTE PROCEDURE exchrate_record_version();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS exchange_rate_version_update ON exchange_rate;
+DROP TRIGGER IF EXISTS exchange_rate_version_insert ON exchange_rate;
+DROP FUNCTION IF EXISTS exchrate_record_version();
+DROP TABLE IF EXISTS exchange_rate_version;
@@ -0,0 +1,74 @@
+-- +migrate Up
+-- kind is either 'write' (polled or imported), 'override' or 'void'. the corrections are made by an actor for a reason
+ALTER TABLE exchange_rate_version
+  ADD COLUMN kind VARCHAR(16) NOT NULL DEFAULT 'write',
+  ADD COLUMN actor VARCHAR(64) NOT NULL DEFAULT '',
+  ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+
+-- the kind, actor and reason of a change are taken from the exchrates.change_* settings of the transaction.
+-- a rate is only deleted by a void, other deletes are the purges of the retention policy.
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION exchrate_record_version() RETURNS TRIGGER AS $$
+DECLARE
+  change_kind TEXT := COALESCE(NULLIF(current_setting('exchrates.change_kind', true), ''), 'write');
+  rec exchange_rate;
+BEGIN
+  IF TG_OP = 'DELETE' AND change_kind <> 'void' THEN
+    RETURN NULL;
+  END IF;
+  IF TG_OP IN ('UPDATE', 'DELETE') THEN
+    UPDATE exchange_rate_version SET superseded_at = now()
+    WHERE time = OLD.time AND currency = OLD.currency AND quote = OLD.quote AND source = OLD.source
+      AND superseded_at IS NULL;
+  END IF;
+  IF TG_OP = 'DELETE' THEN
+    rec := OLD;
+  ELSE
+    rec := NEW;
+  END IF;
+  INSERT INTO exchange_rate_version (time, currency, quote, source, rate, recorded_at, kind, actor, reason)
+  VALUES (rec.time, rec.currency, rec.quote, rec.source, rec.rate, now(), change_kind,
+    COALESCE(current_setting('exchrates.change_actor', true), ''),
+    COALESCE(current_setting('exchrates.change_reason', true), ''));
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+-- an override is recorded even if it keeps the rate
+DROP TRIGGER IF EXISTS exchange_rate_version_update ON exchange_rate;
+CREATE TRIGGER exchange_rate_version_update AFTER UPDATE ON exchange_rate
+  FOR EACH ROW WHEN (OLD.rate IS DISTINCT FROM NEW.rate OR current_setting('exchrates.change_kind', true) = 'override')
+  EXECUTE PROCEDURE exchrate_record_version();
+
+CREATE TRIGGER exchange_rate_version_delete AFTER DELETE ON exchange_rate
+  FOR EACH ROW EXECUTE PROCEDURE exchrate_record_version();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS exchange_rate_version_delete ON exchange_rate;
+DROP TRIGGER IF EXISTS exchange_rate_version_update ON exchange_rate;
+CREATE TRIGGER exchange_rate_version_update AFTER UPDATE ON exchange_rate
+  FOR EACH ROW WHEN (OLD.rate IS DISTINCT FROM NEW.rate) EXECUTE PROCEDURE exchrate_record_version();
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION exchrate_record_version() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'UPDATE' THEN
+    UPDATE exchange_rate_version SET superseded_at = now()
+    WHERE time = OLD.time AND currency = OLD.currency AND quote = OLD.quote AND source = OLD.source
+      AND superseded_at IS NULL;
+  END IF;
+  INSERT INTO exchange_rate_version (time, currency, quote, source, rate, recorded_at)
+  VALUES (NEW.time, NEW.currency, NEW.quote, NEW.source, NEW.rate, now());
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+-- the voided rates stay voided
+DELETE FROM exchange_rate_version WHERE kind = 'void';
+
+ALTER TABLE exchange_rate_version
+  DROP COLUMN reason,
+  DROP COLUMN actor,
+  DROP COLUMN kind;
@@ -0,0 +1,30 @@
+-- +migrate Up
+-- the official rate of a pair per day, made once from the rates before the cut-off time
+CREATE TABLE exchange_rate_fixing
+(
+  date DATE NOT NULL,
+  currency VARCHAR(3) NOT NULL,
+  quote VARCHAR(3) NOT NULL,
+  cutoff TIMESTAMPTZ NOT NULL,
+  method VARCHAR(16) NOT NULL,
+  window_seconds BIGINT NOT NULL,
+  rate NUMERIC NOT NULL,
+  samples BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (date, currency, quote)
+);
+
+-- +migrate StatementBegin
+CREATE FUNCTION exchrate_fixing_immutable() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'fixings are immutable';
+END
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER exchange_rate_fixing_immutable BEFORE UPDATE OR DELETE ON exchange_rate_fixing
+  FOR EACH ROW EXECUTE PROCEDURE exchrate_fixing_immutable();
+
+-- +migrate Down
+DROP TABLE IF EXISTS exchange_rate_fixing;
+DROP FUNCTION IF EXISTS exchrate_fixing_immutable();
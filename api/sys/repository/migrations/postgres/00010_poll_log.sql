@@ -0,0 +1,16 @@
+-- +migrate Up
+-- the attempts of the poller, error being empty for the successful ones
+CREATE TABLE exchange_rate_poll
+(
+  id BIGSERIAL PRIMARY KEY,
+  time TIMESTAMPTZ NOT NULL,
+  currency VARCHAR(3) NOT NULL,
+  quote VARCHAR(3) NOT NULL,
+  source VARCHAR(64) NOT NULL,
+  error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX exchange_rate_poll_time_idx ON exchange_rate_poll (time);
+
+-- +migrate Down
+DROP TABLE IF EXISTS exchange_rate_poll;
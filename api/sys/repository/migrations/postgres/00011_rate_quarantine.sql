@@ -0,0 +1,38 @@
+-- +migrate Up
+-- the polled rates held back as suspicious, till they are released into exchange_rate or discarded
+CREATE TABLE exchange_rate_quarantine
+(
+  id BIGSERIAL PRIMARY KEY,
+  time TIMESTAMPTZ NOT NULL,
+  currency VARCHAR(3) NOT NULL,
+  quote VARCHAR(3) NOT NULL,
+  source VARCHAR(64) NOT NULL,
+  rate NUMERIC NOT NULL,
+  expected NUMERIC NOT NULL,
+  score DOUBLE PRECISION NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  actor TEXT NOT NULL DEFAULT '',
+  reason TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  reviewed_at TIMESTAMPTZ
+);
+
+CREATE INDEX exchange_rate_quarantine_status_idx ON exchange_rate_quarantine (status, created_at);
+
+-- every quarantine, release and discard is an event on the exchrate_quarantine channel. Only the id is sent, as
+-- a payload is limited to 8000 bytes and the reason of a review is not
+-- +migrate StatementBegin
+CREATE FUNCTION exchrate_notify_quarantine() RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('exchrate_quarantine', NEW.id::text);
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE TRIGGER exchange_rate_quarantine_notify AFTER INSERT OR UPDATE ON exchange_rate_quarantine
+  FOR EACH ROW EXECUTE PROCEDURE exchrate_notify_quarantine();
+
+-- +migrate Down
+DROP TABLE IF EXISTS exchange_rate_quarantine;
+DROP FUNCTION IF EXISTS exchrate_notify_quarantine();
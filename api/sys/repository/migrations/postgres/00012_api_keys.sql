@@ -0,0 +1,15 @@
+-- +migrate Up
+-- the API clients, whose keys are stored hashed
+CREATE TABLE exchange_rate_api_key
+(
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE,
+  role VARCHAR(16) NOT NULL,
+  prefix VARCHAR(16) NOT NULL,
+  hash VARCHAR(64) NOT NULL UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  revoked_at TIMESTAMPTZ
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS exchange_rate_api_key;
@@ -0,0 +1,14 @@
+-- +migrate Up
+-- the daily usage of the API per client
+CREATE TABLE exchange_rate_api_usage
+(
+  date DATE NOT NULL,
+  client TEXT NOT NULL,
+  requests BIGINT NOT NULL DEFAULT 0,
+  cost BIGINT NOT NULL DEFAULT 0,
+  rejected BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (date, client)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS exchange_rate_api_usage;
@@ -0,0 +1,35 @@
+-- +migrate Up
+-- every statement that changes the rates is an event on the exchrate_change channel, which the replicas drop their
+-- cached reads on. So are the purges of the rollups and of the versions by the compaction, which change the reads
+-- as well. The statements that change no rows, as the imports of the rates already stored or the compaction passes
+-- with nothing to purge, are not events. The events of a transaction are sent once it commits, the same ones only once.
+-- +migrate StatementBegin
+CREATE FUNCTION exchrate_notify_change() RETURNS TRIGGER AS $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM changed) THEN
+    PERFORM pg_notify('exchrate_change', TG_TABLE_NAME);
+  END IF;
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+-- a trigger with a transition table fires on a single event
+CREATE TRIGGER exchange_rate_insert_notify AFTER INSERT ON exchange_rate
+  REFERENCING NEW TABLE AS changed FOR EACH STATEMENT EXECUTE PROCEDURE exchrate_notify_change();
+CREATE TRIGGER exchange_rate_update_notify AFTER UPDATE ON exchange_rate
+  REFERENCING NEW TABLE AS changed FOR EACH STATEMENT EXECUTE PROCEDURE exchrate_notify_change();
+CREATE TRIGGER exchange_rate_delete_notify AFTER DELETE ON exchange_rate
+  REFERENCING OLD TABLE AS changed FOR EACH STATEMENT EXECUTE PROCEDURE exchrate_notify_change();
+CREATE TRIGGER exchange_rate_rollup_purge_notify AFTER DELETE ON exchange_rate_rollup
+  REFERENCING OLD TABLE AS changed FOR EACH STATEMENT EXECUTE PROCEDURE exchrate_notify_change();
+CREATE TRIGGER exchange_rate_version_purge_notify AFTER DELETE ON exchange_rate_version
+  REFERENCING OLD TABLE AS changed FOR EACH STATEMENT EXECUTE PROCEDURE exchrate_notify_change();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS exchange_rate_version_purge_notify ON exchange_rate_version;
+DROP TRIGGER IF EXISTS exchange_rate_rollup_purge_notify ON exchange_rate_rollup;
+DROP TRIGGER IF EXISTS exchange_rate_delete_notify ON exchange_rate;
+DROP TRIGGER IF EXISTS exchange_rate_update_notify ON exchange_rate;
+DROP TRIGGER IF EXISTS exchange_rate_insert_notify ON exchange_rate;
+DROP FUNCTION IF EXISTS exchrate_notify_change();
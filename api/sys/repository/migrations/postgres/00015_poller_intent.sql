@@ -0,0 +1,11 @@
+-- +migrate Up
+-- whether the poller is meant to run, per leader lock key, so that it holds for whichever replica leads
+CREATE TABLE exchange_rate_poller_intent
+(
+  lock_key BIGINT PRIMARY KEY,
+  wanted BOOLEAN NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS exchange_rate_poller_intent;
@@ -1,14 +1,46 @@
 package repository
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
 )
 
 type RatesQueryOpts struct {
 	Currency          string
+	Quote             string
 	From              time.Time
 	Till              time.Time
 	Limit             uint64
 	Offset            uint64
 	SecondsInInterval uint64
+	Location          *time.Location // the intervals are aligned in, UTC if nil
+	AsOf              time.Time      // the rates are read as they were known at, the current ones if zero
+	Fill              string         // how the intervals without rates are filled, they are left out if empty
+}
+
+type ExportQueryOpts struct {
+	Currencies        []string
+	Quote             string
+	From              time.Time
+	Till              time.Time
+	SecondsInInterval uint64
+	Location          *time.Location // the intervals are aligned in, UTC if nil
+}
+
+type FailedExchrate struct {
+	Exchrate entity.Exchrate
+	Err      error
+}
+
+// BatchError lists the rates of a batch that were not stored.
+type BatchError struct {
+	Failed []FailedExchrate
+}
+
+func (e *BatchError) Error() string {
+	f := e.Failed[0]
+	return fmt.Sprintf("%d rates of the batch were rejected, first: %s at %v: %v",
+		len(e.Failed), f.Exchrate.Currency, f.Exchrate.Time, f.Err)
 }
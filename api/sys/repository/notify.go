@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/nettyrnp/exch-rates/api/common"
+)
+
+// changeChannel is notified of every write of the rates, see the migration 00014
+const changeChannel = "exchrate_change"
+
+const (
+	listenMinReconnect = 10 * time.Second
+	listenMaxReconnect = time.Minute
+	listenPing         = 90 * time.Second
+)
+
+// ChangeListener passes on the notifications of the changes of the rates, written by any replica or by the CLI.
+type ChangeListener struct {
+	listener *pq.Listener
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// ListenChanges calls fn on every change of the rates committed since. The changes made while the connection
+// is lost are not notified, so fn is called as well once the connection is restored.
+func (r *RDBMSRepository) ListenChanges(fn func()) (*ChangeListener, error) {
+	l := pq.NewListener(r.Cfg.DSN, listenMinReconnect, listenMaxReconnect, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			common.LogErrorf("listening to %s: %v", changeChannel, err)
+		}
+	})
+	if err := l.Listen(changeChannel); err != nil {
+		l.Close()
+		return nil, errors.Wrapf(err, "listening to %s", changeChannel)
+	}
+
+	c := &ChangeListener{listener: l, done: make(chan struct{}), stopped: make(chan struct{})}
+	go c.run(fn)
+	return c, nil
+}
+
+func (c *ChangeListener) run(fn func()) {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(listenPing)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.listener.Notify: // nil once the connection is restored
+			fn()
+		case <-ticker.C:
+			go c.listener.Ping()
+		}
+	}
+}
+
+func (c *ChangeListener) Close() error {
+	close(c.done)
+	<-c.stopped
+	return c.listener.Close()
+}
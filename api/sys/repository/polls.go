@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// AddPoll records an attempt of the poller, for the provider error ratio of the quality report.
+func (r *RDBMSRepository) AddPoll(ctx context.Context, p entity.Poll) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO exchange_rate_poll (time, currency, quote, source, error)
+			VALUES ($1, $2, $3, $4, $5)`, p.Time, p.Currency, p.Quote, p.Source, p.Error)
+		return err
+
+	}, sql.LevelReadCommitted)
+}
+
+// GetPollStats counts the polls of the currencies within [from, till] per pair and source.
+func (r *RDBMSRepository) GetPollStats(ctx context.Context, currencies []string, from, till time.Time) ([]entity.PollStat, error) {
+	var stats []entity.PollStat
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT currency, quote, source, count(*), count(*) FILTER (WHERE error <> '')
+			FROM exchange_rate_poll
+			WHERE currency = ANY($1) AND time >= $2 AND time <= $3
+			GROUP BY currency, quote, source`, pq.Array(currencies), from, till)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		stats = nil
+		for rows.Next() {
+			var s entity.PollStat
+			if err := rows.Scan(&s.Currency, &s.Quote, &s.Source, &s.Polls, &s.Errors); err != nil {
+				return err
+			}
+			stats = append(stats, s)
+		}
+		return rows.Err()
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return nil, execErr
+	}
+	return stats, nil
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	qu "github.com/Masterminds/squirrel"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// GetRecentExchrates returns the last n rates of the pair from the source before the time, oldest first.
+func (r *RDBMSRepository) GetRecentExchrates(ctx context.Context, currency, quote, source string, before time.Time, n int) ([]entity.Exchrate, error) {
+	var exchrates []entity.Exchrate
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT time, currency, quote, rate, source FROM (
+				SELECT time, currency, quote, rate, source FROM exchange_rate
+				WHERE currency = $1 AND quote = $2 AND source = $3 AND time < $4
+				ORDER BY time DESC
+				LIMIT $5) r
+			ORDER BY time`, currency, quote, source, before, n)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		exchrates = nil
+		for rows.Next() {
+			var e entity.Exchrate
+			if err := rows.Scan(&e.Time, &e.Currency, &e.Quote, &e.Rate, &e.Source); err != nil {
+				return err
+			}
+			exchrates = append(exchrates, e)
+		}
+		return rows.Err()
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return nil, execErr
+	}
+	return exchrates, nil
+}
+
+// QuarantineExchrate holds the rate back for a review and returns the id of the quarantined rate.
+func (r *RDBMSRepository) QuarantineExchrate(ctx context.Context, q entity.Quarantined) (int64, error) {
+	var id int64
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, `INSERT INTO exchange_rate_quarantine
+			(time, currency, quote, source, rate, expected, score)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id`, q.Time, q.Currency, q.Quote, q.Source, q.Rate, q.Expected, q.Score).Scan(&id)
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return 0, execErr
+	}
+	return id, nil
+}
+
+// GetQuarantined returns the quarantined rates in the status, all of them if status is empty, latest first.
+func (r *RDBMSRepository) GetQuarantined(ctx context.Context, status string, limit, offset uint64) ([]entity.Quarantined, error) {
+	var quarantined []entity.Quarantined
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		where := qu.Sqlizer(qu.And{})
+		if status != "" {
+			where = qu.Eq{"status": status}
+		}
+		query, args, err := qu.StatementBuilder.PlaceholderFormat(qu.Dollar).
+			Select("id", "time", "currency", "quote", "source", "rate", "expected", "score", "status", "actor", "reason",
+				"created_at", "reviewed_at").
+			From("exchange_rate_quarantine").
+			Where(where).
+			OrderBy("created_at DESC", "id DESC").
+			Limit(limit).
+			Offset(offset).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		quarantined = []entity.Quarantined{}
+		for rows.Next() {
+			var q entity.Quarantined
+			if err := rows.Scan(&q.ID, &q.Time, &q.Currency, &q.Quote, &q.Source, &q.Rate, &q.Expected, &q.Score,
+				&q.Status, &q.Actor, &q.Reason, &q.CreatedAt, &q.ReviewedAt); err != nil {
+				return err
+			}
+			quarantined = append(quarantined, q)
+		}
+		return rows.Err()
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return nil, execErr
+	}
+	return quarantined, nil
+}
+
+// ReleaseQuarantined stores the pending quarantined rate as it was polled. ErrNotFound is returned if there is
+// no such pending rate.
+func (r *RDBMSRepository) ReleaseQuarantined(ctx context.Context, id int64, review entity.Review) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		q, err := reviewQuarantined(ctx, tx, id, entity.QuarantineReleased, review)
+		if err != nil {
+			return err
+		}
+
+		query, args, err := qu.StatementBuilder.PlaceholderFormat(qu.Dollar).
+			Insert("exchange_rate").Columns("time", "currency", "quote", "rate", "source").
+			Values(q.Time, q.Currency, q.Quote, q.Rate, q.Source).
+			Suffix(upsertExchrate).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		written, writtenArgs := writtenRates([]entity.Exchrate{q.Exchrate()})
+		return refreshRollups(ctx, tx, written, writtenArgs...)
+
+	}, sql.LevelReadCommitted)
+}
+
+// DiscardQuarantined drops the pending quarantined rate for good. ErrNotFound is returned if there is no such
+// pending rate.
+func (r *RDBMSRepository) DiscardQuarantined(ctx context.Context, id int64, review entity.Review) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		_, err := reviewQuarantined(ctx, tx, id, entity.QuarantineDiscarded, review)
+		return err
+
+	}, sql.LevelReadCommitted)
+}
+
+// reviewQuarantined moves the pending quarantined rate into the status and returns it
+func reviewQuarantined(ctx context.Context, tx *sql.Tx, id int64, status string, review entity.Review) (entity.Quarantined, error) {
+	var q entity.Quarantined
+	err := tx.QueryRowContext(ctx, `UPDATE exchange_rate_quarantine
+		SET status = $2, actor = $3, reason = $4, reviewed_at = now()
+		WHERE id = $1 AND status = $5
+		RETURNING time, currency, quote, source, rate`, id, status, review.Actor, review.Reason, entity.QuarantinePending).
+		Scan(&q.Time, &q.Currency, &q.Quote, &q.Source, &q.Rate)
+	if err == sql.ErrNoRows {
+		return q, ErrNotFound
+	}
+	return q, err
+}
@@ -5,54 +5,88 @@ import (
 	"database/sql"
 	qu "github.com/Masterminds/squirrel"
 	_ "github.com/lib/pq"
+	"github.com/nettyrnp/exch-rates/api/metrics"
 	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/tracing"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"runtime"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Driver string
-	DSN    string
+	Driver    string
+	DSN       string
+	Retention RetentionPolicy
 }
 
 type Repository interface {
-	GetAverage(ctx context.Context, currency string, from, till time.Time) (float64, error)
+	GetAverage(ctx context.Context, currency, quote string, from, till time.Time) (decimal.Decimal, error)
 	GetHistory(ctx context.Context, opts RatesQueryOpts) ([]entity.Average, int, error)
-	GetMomental(ctx context.Context, currency string, moment time.Time) (float64, error)
+	GetMomental(ctx context.Context, currency, quote string, moment, asOf time.Time) (decimal.Decimal, error)
+	GetStatus(ctx context.Context, currency, quote string, moment time.Time, spans []time.Duration) ([]decimal.Decimal, error)
 	AddExchrate(ctx context.Context, e *entity.Exchrate) error
+	AddExchrates(ctx context.Context, es []entity.Exchrate) error
+	StreamExchrates(ctx context.Context, opts ExportQueryOpts, fn func(e entity.Exchrate) error) error
+	StreamBuckets(ctx context.Context, opts ExportQueryOpts, fn func(b entity.Bucket) error) error
+	Compact(ctx context.Context, now time.Time) (bool, error)
+	ImportExchrates(ctx context.Context, mode string, next func() ([]ImportRow, error)) (ImportResult, error)
+	OverrideExchrate(ctx context.Context, c entity.Correction) error
+	VoidExchrate(ctx context.Context, c entity.Correction) error
+	GetExchrateVersions(ctx context.Context, key entity.Exchrate) ([]entity.RateVersion, error)
+	GetFixingSample(ctx context.Context, spec entity.FixingSpec, cutoff time.Time) (decimal.Decimal, int64, error)
+	AddFixing(ctx context.Context, f entity.Fixing) (bool, error)
+	GetFixings(ctx context.Context, date string) ([]entity.Fixing, error)
+	AddPoll(ctx context.Context, p entity.Poll) error
+	GetPollStats(ctx context.Context, currencies []string, from, till time.Time) ([]entity.PollStat, error)
+	GetRecentExchrates(ctx context.Context, currency, quote, source string, before time.Time, n int) ([]entity.Exchrate, error)
+	QuarantineExchrate(ctx context.Context, q entity.Quarantined) (int64, error)
+	GetQuarantined(ctx context.Context, status string, limit, offset uint64) ([]entity.Quarantined, error)
+	ReleaseQuarantined(ctx context.Context, id int64, review entity.Review) error
+	DiscardQuarantined(ctx context.Context, id int64, review entity.Review) error
+	AddAPIKey(ctx context.Context, k entity.APIKey, hash string) (entity.APIKey, error)
+	GetAPIKeys(ctx context.Context) ([]entity.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (*entity.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int64) error
+	AddUsage(ctx context.Context, usage []entity.Usage) error
+	GetUsage(ctx context.Context, date string) ([]entity.Usage, error)
+	Ping(ctx context.Context) error
+	MigrateStatus() ([]MigrationStatus, error)
 }
 
+// upsertExchrate makes the rate writes idempotent on the natural key of a rate
+const upsertExchrate = "ON CONFLICT (time, currency, quote, source) DO UPDATE SET rate = EXCLUDED.rate"
+
+// insertChunkSize keeps multi-row inserts well below the limit of bind parameters per statement
+const insertChunkSize = 1000
+
 type RDBMSRepository struct {
 	Name string
 	db   *sql.DB
 	Cfg  Config
 }
 
-func (r *RDBMSRepository) GetAverage(ctx context.Context, currency string, from, till time.Time) (float64, error) {
-	var rate float64
+func (r *RDBMSRepository) GetAverage(ctx context.Context, currency, quote string, from, till time.Time) (decimal.Decimal, error) {
+	var rate decimal.Decimal
 
-	execErr := r.runInTx(func(tx *sql.Tx) error {
-		var rate0 float64
-		selectMax := qu.StatementBuilder.PlaceholderFormat(qu.Dollar).
-			Select("AVG(rate)").
-			From("exchange_rate")
-		queryRows, args, err := selectMax.
-			Where(qu.And{qu.Eq{"currency": currency}, qu.GtOrEq{"time": from}, qu.LtOrEq{"time": till}}).
-			ToSql()
-		if err != nil {
-			return err
-		}
-		if err := tx.QueryRowContext(ctx, queryRows, args...).Scan(&rate0); err != nil {
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		samples, args := tieredSamples([]string{currency}, quote, from, till, 0, time.UTC)
+
+		var rate0 decimal.Decimal
+		query := dollarQuery("SELECT avg(rate) FROM (" + sourceRates(samples) + ") p")
+		if err := tx.QueryRowContext(ctx, query, args...).Scan(&rate0); err != nil {
 			return err
 		}
 
 		rate = rate0
 		return nil
 
-	}, sql.LevelReadCommitted)
+	}, sql.LevelRepeatableRead)
 
 	if execErr != nil {
-		return 0, execErr
+		return decimal.Zero, execErr
 	}
 	return rate, nil
 }
@@ -61,19 +95,39 @@ func (r *RDBMSRepository) GetHistory(ctx context.Context, opts RatesQueryOpts) (
 	var exchrates []entity.Average
 	var total int
 
-	execErr := r.runInTx(func(tx *sql.Tx) error {
-		rows, err := tx.QueryContext(ctx, "SELECT extract(epoch from time)::int/$1 AS AggregatedTime, avg(rate) "+
-			"FROM exchange_rate "+
-			"WHERE currency=$2 AND time>=$3 AND time<=$4 "+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		loc := locationOrUTC(opts.Location)
+		samples, sampleArgs := tieredSamples([]string{opts.Currency}, opts.Quote, opts.From, opts.Till, opts.SecondsInInterval, loc)
+		if !opts.AsOf.IsZero() {
+			if err := checkVersionsKept(ctx, tx, opts.From); err != nil {
+				return err
+			}
+			samples, sampleArgs = versionSamples([]string{opts.Currency}, opts.Quote, opts.From, opts.Till, opts.AsOf)
+		}
+
+		if opts.Fill != "" && opts.Fill != entity.FillNone {
+			exchrates0, err := filledHistory(ctx, tx, opts, samples, sampleArgs)
+			if err != nil {
+				return err
+			}
+
+			exchrates = exchrates0
+			return nil
+		}
+
+		args := append([]interface{}{loc.String(), opts.SecondsInInterval}, sampleArgs...)
+		args = append(args, opts.Limit, opts.Offset)
+		rows, err := tx.QueryContext(ctx, dollarQuery("SELECT AggregatedTime, avg(rate) "+
+			"FROM ("+sourceRates(samples, localEpoch+"/? AS AggregatedTime")+") p "+
 			"GROUP BY AggregatedTime "+
 			"ORDER BY AggregatedTime "+
-			"LIMIT $5 OFFSET $6 ",
-			opts.SecondsInInterval, opts.Currency, opts.From, opts.Till, opts.Limit, opts.Offset)
+			"LIMIT ? OFFSET ? "),
+			args...)
 		if err != nil {
 			return err
 		}
 
-		exchrates0, err := scanExchrateRows(rows, opts.SecondsInInterval, opts.Limit) // todo: return and pass on the total
+		exchrates0, err := scanExchrateRows(rows, opts.SecondsInInterval, opts.Limit, loc) // todo: return and pass on the total
 		if err != nil {
 			return err
 		}
@@ -81,7 +135,7 @@ func (r *RDBMSRepository) GetHistory(ctx context.Context, opts RatesQueryOpts) (
 		exchrates = exchrates0
 		return nil
 
-	}, sql.LevelReadCommitted)
+	}, sql.LevelRepeatableRead)
 
 	if execErr != nil {
 		return nil, 0, execErr
@@ -89,16 +143,30 @@ func (r *RDBMSRepository) GetHistory(ctx context.Context, opts RatesQueryOpts) (
 	return exchrates, total, nil
 }
 
-func (r *RDBMSRepository) GetMomental(ctx context.Context, currency string, moment time.Time) (float64, error) {
-	var rate float64
+// GetMomental returns the last rate of the currency in the quote at the moment, averaged over the sources that
+// have a rate at that time. If asOf is set, the rate is the one that was known at asOf, ignoring the rates written
+// or overwritten since.
+func (r *RDBMSRepository) GetMomental(ctx context.Context, currency, quote string, moment, asOf time.Time) (decimal.Decimal, error) {
+	var rate decimal.Decimal
+
+	table, known := "exchange_rate", qu.Sqlizer(qu.And{})
+	if !asOf.IsZero() {
+		table, known = versionsTable, knownAt(asOf)
+	}
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		if !asOf.IsZero() {
+			if err := checkVersionsKept(ctx, tx, moment); err != nil {
+				return err
+			}
+		}
 
-	execErr := r.runInTx(func(tx *sql.Tx) error {
 		var closestTime time.Time
 		selectMax := qu.StatementBuilder.PlaceholderFormat(qu.Dollar). // todo: in single query with selectExchrates
 										Select("MAX(time)").
-										From("exchange_rate")
+										From(table)
 		queryRows, args, err := selectMax.
-			Where(qu.And{qu.Eq{"currency": currency}, qu.LtOrEq{"time": moment}}).
+			Where(qu.And{qu.Eq{"currency": currency}, qu.Eq{"quote": quote}, qu.LtOrEq{"time": moment}, known}).
 			Limit(1).ToSql()
 		if err != nil {
 			return err
@@ -108,15 +176,15 @@ func (r *RDBMSRepository) GetMomental(ctx context.Context, currency string, mome
 		}
 
 		selectExchrates := qu.StatementBuilder.PlaceholderFormat(qu.Dollar).
-			Select("rate").
-			From("exchange_rate")
+			Select("avg(rate)").
+			From(table)
 		query, args, err := selectExchrates.
-			Where(qu.And{qu.Eq{"currency": currency}, qu.Eq{"time": closestTime}}).
-			Limit(1).ToSql()
+			Where(qu.And{qu.Eq{"currency": currency}, qu.Eq{"quote": quote}, qu.Eq{"time": closestTime}, known}).
+			ToSql()
 		if err != nil {
 			return err
 		}
-		var rate0 float64
+		var rate0 decimal.Decimal
 		if err := tx.QueryRowContext(ctx, query, args...).Scan(&rate0); err != nil {
 			return err
 		}
@@ -127,16 +195,61 @@ func (r *RDBMSRepository) GetMomental(ctx context.Context, currency string, mome
 	}, sql.LevelReadCommitted)
 
 	if execErr != nil {
-		return 0, execErr
+		return decimal.Zero, execErr
 	}
 	return rate, nil
 }
 
+// GetStatus returns the last rate of the currency in the quote at the moment, followed by its average rate over
+// each of the spans till the moment, the sources being averaged the same as by GetMomental and GetAverage.
+// All of them are answered by a single query, mostly from the rollups.
+func (r *RDBMSRepository) GetStatus(ctx context.Context, currency, quote string, moment time.Time, spans []time.Duration) ([]decimal.Decimal, error) {
+	var res []decimal.Decimal
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		columns := []string{"(SELECT avg(rate) FROM exchange_rate WHERE currency = ? AND quote = ? AND time = " +
+			"(SELECT max(time) FROM exchange_rate WHERE currency = ? AND quote = ? AND time <= ?))"}
+		args := []interface{}{currency, quote, currency, quote, moment}
+		for _, span := range spans {
+			samples, sampleArgs := tieredSamples([]string{currency}, quote, moment.Add(-span), moment, 0, time.UTC)
+			columns = append(columns, "(SELECT avg(rate) FROM ("+sourceRates(samples)+") p)")
+			args = append(args, sampleArgs...)
+		}
+
+		rates := make([]decimal.NullDecimal, len(columns))
+		dest := make([]interface{}, len(rates))
+		for i := range rates {
+			dest[i] = &rates[i]
+		}
+		query := dollarQuery("SELECT " + strings.Join(columns, ", "))
+		if err := tx.QueryRowContext(ctx, query, args...).Scan(dest...); err != nil {
+			return err
+		}
+
+		res = make([]decimal.Decimal, 0, len(rates))
+		for _, rate := range rates {
+			if !rate.Valid {
+				return errors.Errorf("no rates of '%s' till %v", currency, moment)
+			}
+			res = append(res, rate.Decimal)
+		}
+		return nil
+
+	}, sql.LevelRepeatableRead)
+
+	if execErr != nil {
+		return nil, execErr
+	}
+	return res, nil
+}
+
+// AddExchrate stores e, replacing the rate already stored for the same time, pair and source.
 func (r *RDBMSRepository) AddExchrate(ctx context.Context, e *entity.Exchrate) error {
-	return r.runInTx(func(tx *sql.Tx) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
 		psql := qu.StatementBuilder.PlaceholderFormat(qu.Dollar)
-		query, args, err := psql.Insert("exchange_rate").Columns("time", "currency", "rate").
-			Values(e.Time, e.Currency, e.Rate).
+		query, args, err := psql.Insert("exchange_rate").Columns("time", "currency", "quote", "rate", "source").
+			Values(e.Time, e.Currency, e.Quote, e.Rate, e.Source).
+			Suffix(upsertExchrate).
 			ToSql()
 		if err != nil {
 			return err
@@ -145,12 +258,155 @@ func (r *RDBMSRepository) AddExchrate(ctx context.Context, e *entity.Exchrate) e
 			return execErr
 		}
 
-		return nil
+		written, writtenArgs := writtenRates([]entity.Exchrate{*e})
+		return refreshRollups(ctx, tx, written, writtenArgs...)
 
 	}, sql.LevelSerializable)
 }
 
-func scanExchrateRows(rows *sql.Rows, secondsInInterval, limit uint64) ([]entity.Average, error) {
+// AddExchrates stores a batch of rates in a single transaction, keeping their order. Like with AddExchrate,
+// the rates already stored for the same keys are replaced, and within the batch the last rate of a key wins.
+// Invalid rates are left out and reported with a *BatchError, while the rest of the batch is stored.
+func (r *RDBMSRepository) AddExchrates(ctx context.Context, es []entity.Exchrate) error {
+	valid := make([]entity.Exchrate, 0, len(es))
+	batchErr := &BatchError{}
+	for _, e := range es {
+		if err := e.Validate(); err != nil {
+			batchErr.Failed = append(batchErr.Failed, FailedExchrate{Exchrate: e, Err: err})
+			continue
+		}
+		valid = append(valid, e)
+	}
+	valid = lastPerKey(valid)
+
+	if len(valid) > 0 {
+		execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+			psql := qu.StatementBuilder.PlaceholderFormat(qu.Dollar)
+			for start := 0; start < len(valid); start += insertChunkSize {
+				end := start + insertChunkSize
+				if end > len(valid) {
+					end = len(valid)
+				}
+				insert := psql.Insert("exchange_rate").Columns("time", "currency", "quote", "rate", "source")
+				for _, e := range valid[start:end] {
+					insert = insert.Values(e.Time, e.Currency, e.Quote, e.Rate, e.Source)
+				}
+				query, args, err := insert.Suffix(upsertExchrate).ToSql()
+				if err != nil {
+					return err
+				}
+				if _, execErr := tx.ExecContext(ctx, query, args...); execErr != nil {
+					return execErr
+				}
+			}
+
+			written, writtenArgs := writtenRates(valid)
+			return refreshRollups(ctx, tx, written, writtenArgs...)
+
+		}, sql.LevelReadCommitted)
+		if execErr != nil {
+			return execErr
+		}
+	}
+
+	if len(batchErr.Failed) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+type rateKey struct {
+	time     time.Time
+	currency string
+	quote    string
+	source   string
+}
+
+// lastPerKey leaves only the last rate of each key, since a single upsert cannot touch the same row twice.
+func lastPerKey(es []entity.Exchrate) []entity.Exchrate {
+	last := make(map[rateKey]int, len(es))
+	for i, e := range es {
+		last[rateKey{e.Time.UTC(), e.Currency, e.Quote, e.Source}] = i
+	}
+	if len(last) == len(es) {
+		return es
+	}
+	res := make([]entity.Exchrate, 0, len(last))
+	for i, e := range es {
+		if last[rateKey{e.Time.UTC(), e.Currency, e.Quote, e.Source}] == i {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// StreamExchrates passes the raw rates to fn one by one, as they are read from the db cursor.
+func (r *RDBMSRepository) StreamExchrates(ctx context.Context, opts ExportQueryOpts, fn func(e entity.Exchrate) error) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		query, args, err := qu.StatementBuilder.PlaceholderFormat(qu.Dollar).
+			Select("id", "time", "currency", "quote", "rate", "source", "created_at").
+			From("exchange_rate").
+			Where(qu.And{qu.Eq{"currency": opts.Currencies}, qu.Eq{"quote": opts.Quote}, qu.GtOrEq{"time": opts.From}, qu.LtOrEq{"time": opts.Till}}).
+			OrderBy("currency", "time").
+			ToSql()
+		if err != nil {
+			return err
+		}
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e entity.Exchrate
+			if err := rows.Scan(&e.ID, &e.Time, &e.Currency, &e.Quote, &e.Rate, &e.Source, &e.CreatedAt); err != nil {
+				return err
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+
+	}, sql.LevelRepeatableRead)
+}
+
+// StreamBuckets passes the aggregated rates to fn one by one, as they are read from the db cursor.
+func (r *RDBMSRepository) StreamBuckets(ctx context.Context, opts ExportQueryOpts, fn func(b entity.Bucket) error) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		loc := locationOrUTC(opts.Location)
+		samples, sampleArgs := tieredSamples(opts.Currencies, opts.Quote, opts.From, opts.Till, opts.SecondsInInterval, loc)
+
+		args := append([]interface{}{loc.String(), opts.SecondsInInterval}, sampleArgs...)
+		rows, err := tx.QueryContext(ctx, dollarQuery("SELECT currency, AggregatedTime, "+
+			"avg(rate), min(min), max(max), sum(count) "+
+			"FROM ("+sourceRates(samples, "currency", localEpoch+"/? AS AggregatedTime")+") p "+
+			"GROUP BY currency, AggregatedTime "+
+			"ORDER BY currency, AggregatedTime "),
+			args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var b entity.Bucket
+			var aggrTime int64
+			if err := rows.Scan(&b.Currency, &aggrTime, &b.Average, &b.Min, &b.Max, &b.Count); err != nil {
+				return err
+			}
+			b.Time = bucketTime(aggrTime, opts.SecondsInInterval, loc)
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+
+	}, sql.LevelRepeatableRead)
+}
+
+func scanExchrateRows(rows *sql.Rows, secondsInInterval, limit uint64, loc *time.Location) ([]entity.Average, error) {
 	exchrates := make([]entity.Average, 0, limit)
 	defer rows.Close()
 
@@ -161,25 +417,63 @@ func scanExchrateRows(rows *sql.Rows, secondsInInterval, limit uint64) ([]entity
 		if err := rows.Scan(&aggrTime, &e.Rate); err != nil {
 			return nil, err
 		}
-		e.Time = time.Unix(aggrTime*int64(secondsInInterval), 0)
+		e.Time = bucketTime(aggrTime, secondsInInterval, loc)
 		exchrates = append(exchrates, *e)
 	}
 	return exchrates, nil
 }
 
+// localEpoch is the epoch of the wall clock of a sample in the time zone passed as its argument,
+// so that the intervals of the history are aligned in that time zone.
+const localEpoch = "floor(extract(epoch from time AT TIME ZONE ?))::bigint"
+
+// bucketTime turns an interval number based on localEpoch back into the start time of the interval in loc.
+func bucketTime(n int64, secondsInInterval uint64, loc *time.Location) time.Time {
+	w := time.Unix(n*int64(secondsInInterval), 0).UTC()
+	return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, loc)
+}
+
+func locationOrUTC(loc *time.Location) *time.Location {
+	if loc == nil {
+		return time.UTC
+	}
+	return loc
+}
+
 func (r *RDBMSRepository) Init() error {
+	if err := checkDialect(r.Cfg.Driver); err != nil {
+		return err
+	}
+
 	var err error
 	r.db, err = connect(r.Cfg)
 	if err != nil {
 		return err
 	}
+	metrics.RegisterDB(r.Name, r.db)
 	return nil
 }
 
+// Close closes the db, waiting for the running queries to complete.
+func (r *RDBMSRepository) Close() error {
+	return r.db.Close()
+}
+
+// Ping checks that the db can be reached.
+func (r *RDBMSRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
 type dbExecutor func(tx *sql.Tx) error
 
-func (r *RDBMSRepository) runInTx(executor dbExecutor, isoLevel sql.IsolationLevel) error {
-	tx, err := r.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: isoLevel})
+// runInTx runs the executor in a transaction, timing and tracing it by the name of the method that runs it.
+func (r *RDBMSRepository) runInTx(ctx context.Context, executor dbExecutor, isoLevel sql.IsolationLevel) (err error) {
+	name := queryName()
+	defer observeQuery(name, time.Now())
+	ctx, span := tracing.Start(ctx, "repository."+name, semconv.DBSystemPostgreSQL)
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: isoLevel})
 	if err != nil {
 		return err
 	}
@@ -194,6 +488,22 @@ func (r *RDBMSRepository) runInTx(executor dbExecutor, isoLevel sql.IsolationLev
 	return tx.Commit()
 }
 
+// queryName returns the name of the method that runs the transaction, e.g. 'GetStatus'
+func queryName() string {
+	pc, _, _, ok := runtime.Caller(2)
+	if !ok {
+		return "unknown"
+	}
+	name := runtime.FuncForPC(pc).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimPrefix(name, "repository.")
+	return strings.TrimPrefix(name, "(*RDBMSRepository).")
+}
+
+func observeQuery(name string, start time.Time) {
+	metrics.QueryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+}
+
 func connect(cfg Config) (*sql.DB, error) {
 	db, openErr := sql.Open(cfg.Driver, cfg.DSN)
 	if openErr != nil {
@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	qu "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// RetentionPolicy tells how long the raw rates and the rollups are kept. Zero keeps them forever.
+// The daily rollups are always kept.
+type RetentionPolicy struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+}
+
+type rollupTier struct {
+	resolution int
+	unit       string
+	source     int
+}
+
+// rollupTiers are ordered from the coarsest one. Each tier is computed from the source one.
+var rollupTiers = []rollupTier{
+	{resolution: 86400, unit: "day", source: 3600},
+	{resolution: 3600, unit: "hour", source: 60},
+	{resolution: 60, unit: "minute", source: rawResolution},
+}
+
+// rawResolution stands for the raw rates in exchange_rate_rollup_state
+const rawResolution = 0
+
+// lockRollups serializes the rollup refreshes and the purges till the end of the transaction, so that a refresh
+// sees the rates committed by the concurrent writers.
+const lockRollups = "SELECT pg_advisory_xact_lock(hashtext('exchange_rate_rollup'))"
+
+// Compact purges the raw rates, along with their versions and the poll log, and the rollups past their retention.
+// The purge boundaries are aligned to days, so that every bucket is either purged or kept in whole. It tells
+// whether any rates, rollups or versions were purged, that is whether the reads may have changed.
+func (r *RDBMSRepository) Compact(ctx context.Context, now time.Time) (bool, error) {
+	retentions := map[int]time.Duration{
+		rawResolution: r.Cfg.Retention.Raw,
+		60:            r.Cfg.Retention.Minute,
+		3600:          r.Cfg.Retention.Hour,
+	}
+
+	var purged bool
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, lockRollups); err != nil {
+			return err
+		}
+
+		for resolution, retention := range retentions {
+			if retention <= 0 {
+				continue
+			}
+			cutoff := now.UTC().Add(-retention).Truncate(24 * time.Hour)
+
+			var purges []string
+			var args []interface{}
+			if resolution == rawResolution {
+				if _, err := tx.ExecContext(ctx, "DELETE FROM exchange_rate_poll WHERE time < $1", cutoff); err != nil {
+					return errors.Wrap(err, "purging polls")
+				}
+				purges, args = []string{"DELETE FROM exchange_rate WHERE time < $1", "DELETE FROM " + versionsTable + " WHERE time < $1"}, []interface{}{cutoff}
+			} else {
+				purges, args = []string{"DELETE FROM exchange_rate_rollup WHERE bucket < $1 AND resolution = $2"}, []interface{}{cutoff, resolution}
+			}
+			for _, purge := range purges {
+				res, err := tx.ExecContext(ctx, purge, args...)
+				if err != nil {
+					return errors.Wrapf(err, "purging rates of resolution %d", resolution)
+				}
+				n, err := res.RowsAffected()
+				if err != nil {
+					return err
+				}
+				purged = purged || n > 0
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE exchange_rate_rollup_state SET purged_before = $2
+				WHERE resolution = $1 AND (purged_before IS NULL OR purged_before < $2)`, resolution, cutoff); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return false, execErr
+	}
+	return purged, nil
+}
+
+// writtenRates builds a query of the (time, currency, quote, source, rate) of the rates, for refreshRollups.
+func writtenRates(es []entity.Exchrate) (string, []interface{}) {
+	times := make([]string, len(es))
+	currencies := make([]string, len(es))
+	quotes := make([]string, len(es))
+	sources := make([]string, len(es))
+	rates := make([]string, len(es))
+	for i, e := range es {
+		times[i] = e.Time.Format(time.RFC3339Nano)
+		currencies[i], quotes[i], sources[i], rates[i] = e.Currency, e.Quote, e.Source, e.Rate.String()
+	}
+	return "SELECT * FROM unnest(?::timestamptz[], ?::varchar[], ?::varchar[], ?::varchar[], ?::numeric[]) AS w(time, currency, quote, source, rate)",
+		[]interface{}{pq.Array(times), pq.Array(currencies), pq.Array(quotes), pq.Array(sources), pq.Array(rates)}
+}
+
+// refreshRollups brings the buckets touched by the written rates up to date, from the finest tier to the coarsest.
+// The buckets are kept per source.
+// A bucket is recomputed from its source tier, or dropped if the source has nothing left there, unless the source
+// is already purged there: then the written rates are added to the bucket, which counts twice the rates that
+// overwrite already purged ones.
+// written is a query of the (time, currency, quote, source, rate) of the rates.
+func refreshRollups(ctx context.Context, tx *sql.Tx, written string, args ...interface{}) error {
+	if _, err := tx.ExecContext(ctx, lockRollups); err != nil {
+		return err
+	}
+
+	for i := len(rollupTiers) - 1; i >= 0; i-- {
+		t := rollupTiers[i]
+
+		source := `SELECT s.bucket AS time, s.count, s.sum, s.min, s.max FROM exchange_rate_rollup s
+			WHERE s.resolution = %[2]d AND s.currency = a.currency AND s.quote = a.quote AND s.source = a.source`
+		if t.source == rawResolution {
+			source = `SELECT s.time, 1 AS count, s.rate AS sum, s.rate AS min, s.rate AS max FROM exchange_rate s
+				WHERE s.currency = a.currency AND s.quote = a.quote AND s.source = a.source`
+		}
+		query := fmt.Sprintf(`WITH affected AS (
+				SELECT currency, quote, source, exchrate_trunc('%[1]s', time) AS bucket,
+					count(*) AS count, sum(rate) AS sum, min(rate) AS min, max(rate) AS max
+				FROM (`+written+`) w
+				GROUP BY 1, 2, 3, 4
+			), purged AS (
+				SELECT COALESCE(max(purged_before), '-infinity') AS before FROM exchange_rate_rollup_state WHERE resolution = %[2]d
+			), emptied AS (
+				DELETE FROM exchange_rate_rollup x USING affected a, purged p
+				WHERE x.resolution = %[3]d AND x.currency = a.currency AND x.quote = a.quote AND x.source = a.source
+					AND x.bucket = a.bucket
+					AND a.bucket >= p.before
+					AND NOT EXISTS (`+source+`
+						AND s.%[4]s >= a.bucket AND s.%[4]s < a.bucket + interval '%[3]d seconds')
+			)
+			INSERT INTO exchange_rate_rollup (resolution, bucket, currency, quote, source, count, sum, min, max)
+			SELECT %[3]d, a.bucket, a.currency, a.quote, a.source, sum(s.count), sum(s.sum), min(s.min), max(s.max)
+			FROM affected a, purged p, LATERAL (`+source+`
+				AND s.%[4]s >= a.bucket AND s.%[4]s < a.bucket + interval '%[3]d seconds') s
+			WHERE a.bucket >= p.before
+			GROUP BY a.bucket, a.currency, a.quote, a.source
+			UNION ALL
+			SELECT %[3]d, a.bucket, a.currency, a.quote, a.source, a.count + COALESCE(x.count, 0), a.sum + COALESCE(x.sum, 0),
+				LEAST(a.min, x.min), GREATEST(a.max, x.max)
+			FROM affected a
+			CROSS JOIN purged p
+			LEFT JOIN exchange_rate_rollup x ON x.resolution = %[3]d AND x.currency = a.currency AND x.quote = a.quote
+				AND x.source = a.source AND x.bucket = a.bucket
+			WHERE a.bucket < p.before
+			ON CONFLICT (resolution, currency, quote, source, bucket) DO UPDATE
+				SET count = EXCLUDED.count, sum = EXCLUDED.sum, min = EXCLUDED.min, max = EXCLUDED.max`,
+			t.unit, t.source, t.resolution, sourceTimeColumn(t))
+		if _, err := tx.ExecContext(ctx, dollarQuery(query), args...); err != nil {
+			return errors.Wrapf(err, "refreshing %s rollups", t.unit)
+		}
+	}
+	return nil
+}
+
+func sourceTimeColumn(t rollupTier) string {
+	if t.source == rawResolution {
+		return "time"
+	}
+	return "bucket"
+}
+
+// tieredSamples builds a query of the (time, currency, source, count, sum, min, max) samples of the currencies
+// in the quote within [from, till], where every rate is counted once: as a part of a whole bucket of the coarsest
+// tier that has it, or as a raw rate otherwise. If secondsInInterval is set, only the tiers dividing it are used,
+// so that every bucket falls into a single interval, also when the intervals are aligned in loc rather than in UTC.
+// The tier bounds are resolved by the db, so it takes no extra round trip.
+func tieredSamples(currencies []string, quote string, from, till time.Time, secondsInInterval uint64, loc *time.Location) (string, []interface{}) {
+	from, till = from.UTC(), till.UTC()
+
+	var bounds, parts []string
+	var boundArgs, args []interface{}
+	var covered []string // the [lo, hi) bounds taken by the coarser tiers
+	exclude := func(column string) string {
+		var sb strings.Builder
+		for _, c := range covered {
+			sb.WriteString(fmt.Sprintf(" AND NOT (%[1]s >= b.lo%[2]s AND %[1]s < b.hi%[2]s)", column, c))
+		}
+		return sb.String()
+	}
+
+	for _, t := range rollupTiers {
+		if secondsInInterval > 0 && (secondsInInterval%uint64(t.resolution) != 0 || !alignedIn(loc, from, till, t.resolution)) {
+			continue
+		}
+		bounds = append(bounds, fmt.Sprintf("exchrate_ceil(GREATEST(?::timestamptz, max(purged_before) FILTER (WHERE resolution = %[1]d)), '%[2]s') AS lo%[1]d, "+
+			"exchrate_trunc('%[2]s', ?::timestamptz) AS hi%[1]d", t.resolution, t.unit))
+		boundArgs = append(boundArgs, from, till)
+
+		parts = append(parts, fmt.Sprintf("SELECT r.bucket AS time, r.currency, r.source, r.count, r.sum, r.min, r.max FROM exchange_rate_rollup r, b "+
+			"WHERE r.resolution = %[1]d AND r.currency = ANY(?) AND r.quote = ? AND r.bucket >= b.lo%[1]d AND r.bucket < b.hi%[1]d", t.resolution)+exclude("r.bucket"))
+		args = append(args, pq.Array(currencies), quote)
+		covered = append(covered, fmt.Sprint(t.resolution))
+	}
+
+	parts = append(parts, "SELECT e.time, e.currency, e.source, 1 AS count, e.rate AS sum, e.rate AS min, e.rate AS max FROM exchange_rate e, b "+
+		"WHERE e.currency = ANY(?) AND e.quote = ? AND e.time >= ? AND e.time <= ?"+exclude("e.time"))
+	args = append(args, pq.Array(currencies), quote, from, till)
+
+	query := "WITH b AS (SELECT count(*) AS n" + prefixEach(", ", bounds) + " FROM exchange_rate_rollup_state) " +
+		strings.Join(parts, " UNION ALL ")
+	return query, append(boundArgs, args...)
+}
+
+// sourceRates builds a query of the average rate of every source, along with its min, max and count, over the
+// samples grouped by the columns. The reads average these in turn, so that every source weighs the same however
+// often it is polled.
+func sourceRates(samples string, columns ...string) string {
+	groups := make([]string, 0, len(columns)+1)
+	for i := range columns {
+		groups = append(groups, fmt.Sprint(i+1))
+	}
+	groups = append(groups, fmt.Sprint(len(columns)+1))
+	return "SELECT " + strings.Join(append(columns, "source"), ", ") +
+		", sum(sum)/sum(count) AS rate, min(min) AS min, max(max) AS max, sum(count) AS count " +
+		"FROM (" + samples + ") s GROUP BY " + strings.Join(groups, ", ")
+}
+
+// alignedIn tells whether the buckets of the resolution, which are aligned in UTC, are aligned in loc too
+// all the way from from till till, that is whether every offset of loc in between is a multiple of the resolution.
+func alignedIn(loc *time.Location, from, till time.Time, resolution int) bool {
+	for t := from; ; {
+		_, offset := t.In(loc).Zone()
+		if offset%resolution != 0 {
+			return false
+		}
+		_, end := t.In(loc).ZoneBounds()
+		if end.IsZero() || end.After(till) {
+			return true
+		}
+		t = end
+	}
+}
+
+func prefixEach(prefix string, items []string) string {
+	var sb strings.Builder
+	for _, item := range items {
+		sb.WriteString(prefix + item)
+	}
+	return sb.String()
+}
+
+func dollarQuery(query string) string {
+	q, _ := qu.Dollar.ReplacePlaceholders(query)
+	return q
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTieredSamples(t *testing.T) {
+	t.Parallel()
+
+	at := func(clock string) time.Time {
+		tm, _ := time.Parse("2006-01-02 15:04:05", "2020-03-10 "+clock)
+		return tm
+	}
+	from, till := at("10:30:15"), at("13:20:00")
+
+	t.Run("all tiers", func(t *testing.T) {
+		query, args := tieredSamples([]string{"USD"}, "RUB", from, till, 0, time.UTC)
+		// the tier bounds and a part per tier
+		assert.Equal(t, 5, strings.Count(query, "SELECT"))
+		assert.Equal(t, strings.Count(query, "?"), len(args))
+		assert.Equal(t, []interface{}{from, till, from, till, from, till}, args[:6])
+		assert.Contains(t, query, "NOT (e.time >= b.lo86400 AND e.time < b.hi86400) AND NOT (e.time >= b.lo3600")
+		// every part is of the quote only
+		assert.Equal(t, 4, strings.Count(query, ".quote = ?"))
+	})
+
+	t.Run("tiers dividing the interval", func(t *testing.T) {
+		query, args := tieredSamples([]string{"USD"}, "RUB", from, till, 300, time.UTC)
+		assert.Equal(t, 3, strings.Count(query, "SELECT"))
+		assert.Equal(t, strings.Count(query, "?"), len(args))
+		assert.NotContains(t, query, "86400")
+		assert.NotContains(t, query, "3600")
+	})
+
+	t.Run("tiers aligned in the time zone", func(t *testing.T) {
+		query, _ := tieredSamples([]string{"USD"}, "RUB", from, till, 86400, time.FixedZone("MSK", 3*3600))
+		assert.NotContains(t, query, "86400")
+		assert.Contains(t, query, "3600")
+
+		query, _ = tieredSamples([]string{"USD"}, "RUB", from, till, 86400, time.FixedZone("IST", 5*3600+1800))
+		assert.NotContains(t, query, "3600")
+		assert.Contains(t, query, "r.resolution = 60")
+	})
+}
+
+func TestSourceRates(t *testing.T) {
+	t.Parallel()
+
+	query := sourceRates("SELECT 1", "currency", localEpoch+"/? AS n")
+	assert.True(t, strings.HasPrefix(query, "SELECT currency, "+localEpoch+"/? AS n, source, sum(sum)/sum(count) AS rate"))
+	assert.True(t, strings.HasSuffix(query, "FROM (SELECT 1) s GROUP BY 1, 2, 3"))
+
+	assert.True(t, strings.HasSuffix(sourceRates("SELECT 1"), "GROUP BY 1"))
+}
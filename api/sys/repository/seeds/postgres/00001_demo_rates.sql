@@ -0,0 +1,24 @@
+INSERT INTO exchange_rate (time, currency, rate)
+  VALUES
+    ('2020-03-10 15:07:30+00'::timestamptz,'USD', 79.38426),
+    ('2020-03-10 16:07:30+00'::timestamptz,'USD', 79.4),
+    ('2020-03-10 17:07:30+00'::timestamptz,'USD', 79.58426),
+    ('2020-03-10 18:07:30+00'::timestamptz,'USD', 79.48426),
+
+    ('2020-03-15 15:07:30+00'::timestamptz,'USD', 77.38426),
+    ('2020-03-15 16:07:30+00'::timestamptz,'USD', 77.4),
+    ('2020-03-15 17:07:30+00'::timestamptz,'USD', 77.58426),
+    ('2020-03-15 18:07:30+00'::timestamptz,'USD', 77.48426),
+
+    ('2020-03-20 15:07:30+00'::timestamptz,'USD', 66.7),
+    ('2020-03-20 15:07:00+00'::timestamptz,'USD', 66.78888),
+    ('2020-03-20 15:08:00+00'::timestamptz,'USD', 67.8),
+    ('2020-03-20 15:08:30+00'::timestamptz,'USD', 67.89999),
+    ('2020-03-20 15:09:00+00'::timestamptz,'USD', 68.9),
+
+    ('2020-03-21 17:17:30+00'::timestamptz,'EUR', 86.7),
+    ('2020-03-21 17:17:00+00'::timestamptz,'EUR', 86.78888),
+    ('2020-03-21 17:18:00+00'::timestamptz,'EUR', 87.8),
+    ('2020-03-21 17:18:30+00'::timestamptz,'EUR', 87.89999),
+    ('2020-03-21 17:19:00+00'::timestamptz,'EUR', 88.9)
+  ON CONFLICT (time, currency, quote, source) DO NOTHING;
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// AddUsage adds the usage to what is already recorded for the clients on the days.
+func (r *RDBMSRepository) AddUsage(ctx context.Context, usage []entity.Usage) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		for _, u := range usage {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO exchange_rate_api_usage (date, client, requests, cost, rejected)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (date, client) DO UPDATE SET
+					requests = exchange_rate_api_usage.requests + EXCLUDED.requests,
+					cost = exchange_rate_api_usage.cost + EXCLUDED.cost,
+					rejected = exchange_rate_api_usage.rejected + EXCLUDED.rejected`,
+				u.Date, u.Client, u.Requests, u.Cost, u.Rejected); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	}, sql.LevelReadCommitted)
+}
+
+// GetUsage returns the usage of the clients on the day, given as '2006-01-02', the heaviest first.
+func (r *RDBMSRepository) GetUsage(ctx context.Context, date string) ([]entity.Usage, error) {
+	var usage []entity.Usage
+
+	execErr := r.runInTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT date, client, requests, cost, rejected
+			FROM exchange_rate_api_usage
+			WHERE date = $1
+			ORDER BY cost DESC, client`, date)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		usage = []entity.Usage{}
+		for rows.Next() {
+			var u entity.Usage
+			var day time.Time
+			if err := rows.Scan(&day, &u.Client, &u.Requests, &u.Cost, &u.Rejected); err != nil {
+				return err
+			}
+			u.Date = day.Format(entity.DateFormat)
+			usage = append(usage, u)
+		}
+		return rows.Err()
+
+	}, sql.LevelReadCommitted)
+
+	if execErr != nil {
+		return nil, execErr
+	}
+	return usage, nil
+}
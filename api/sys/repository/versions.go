@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	qu "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+// versionsTable keeps every value the rates ever had, recorded by a trigger on exchange_rate
+const versionsTable = "exchange_rate_version"
+
+// ErrVersionsPurged is returned by the reads as of a knowledge time that reach before the raw retention,
+// since the versions of the rates are purged along with the rates.
+var ErrVersionsPurged = errors.New("the versions of the rates before the raw retention are purged")
+
+// knownAt selects the versions of the rates that were known at asOf, leaving out the rates voided by then
+func knownAt(asOf time.Time) qu.Sqlizer {
+	return qu.And{
+		qu.LtOrEq{"recorded_at": asOf},
+		qu.Or{qu.Eq{"superseded_at": nil}, qu.Gt{"superseded_at": asOf}},
+		qu.NotEq{"kind": entity.VersionVoid},
+	}
+}
+
+// versionSamples builds a query of the same samples as tieredSamples, but as they were known at asOf.
+// The rollups only hold the current rates, so the versions are scanned.
+func versionSamples(currencies []string, quote string, from, till, asOf time.Time) (string, []interface{}) {
+	return "SELECT v.time, v.currency, v.source, 1 AS count, v.rate AS sum, v.rate AS min, v.rate AS max FROM " + versionsTable + " v " +
+			"WHERE v.currency = ANY(?) AND v.quote = ? AND v.time >= ? AND v.time <= ? " +
+			"AND v.recorded_at <= ? AND (v.superseded_at IS NULL OR v.superseded_at > ?) AND v.kind <> ?",
+		[]interface{}{pq.Array(currencies), quote, from, till, asOf, asOf, entity.VersionVoid}
+}
+
+// checkVersionsKept fails with ErrVersionsPurged if the versions of the rates at from were purged by Compact
+func checkVersionsKept(ctx context.Context, tx *sql.Tx, from time.Time) error {
+	var purgedBefore sql.NullTime
+	if err := tx.QueryRowContext(ctx, "SELECT purged_before FROM exchange_rate_rollup_state WHERE resolution = $1",
+		rawResolution).Scan(&purgedBefore); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if purgedBefore.Valid && from.Before(purgedBefore.Time) {
+		return ErrVersionsPurged
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+)
+
+func TestKnownAt(t *testing.T) {
+	t.Parallel()
+
+	asOf := time.Date(2020, 3, 10, 15, 0, 0, 0, time.UTC)
+	query, args, err := knownAt(asOf).ToSql()
+	require.NoError(t, err)
+	assert.Equal(t, "(recorded_at <= ? AND (superseded_at IS NULL OR superseded_at > ?) AND kind <> ?)", query)
+	assert.Equal(t, []interface{}{asOf, asOf, entity.VersionVoid}, args)
+
+	samples, sampleArgs := versionSamples([]string{"USD"}, "RUB", asOf.Add(-time.Hour), asOf, asOf)
+	assert.Equal(t, strings.Count(samples, "?"), len(sampleArgs))
+}
@@ -2,40 +2,107 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/sys/export"
+	"github.com/nettyrnp/exch-rates/api/sys/importer"
 	"github.com/nettyrnp/exch-rates/api/sys/poller"
+	"github.com/nettyrnp/exch-rates/api/sys/quality"
 	"github.com/nettyrnp/exch-rates/api/sys/repository"
+	"github.com/nettyrnp/exch-rates/api/tracing"
 	"github.com/nettyrnp/exch-rates/config"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
 	"math"
+	"sort"
 	"strings"
 	"time"
 )
 
-const minute = uint64(60)
+const (
+	minute          = uint64(60)
+	importBatchSize = 5000
+)
 
 type Service interface {
 	StartPolling()
 	StopPolling()
 
-	GetStatus(ctx context.Context, currency string) ([]float64, error)
-	GetHistory(ctx context.Context, currency string, from, till time.Time, aggrType string, limit, offset uint64) ([]string, int, error)
-	GetMomental(ctx context.Context, currency string, moment time.Time) (float64, error)
+	GetStatus(ctx context.Context, currency string) ([]decimal.Decimal, error)
+	GetHistory(ctx context.Context, currency string, from, till time.Time, aggrType string, loc *time.Location, asOf time.Time, fill string, limit, offset uint64) ([]entity.Average, int, error)
+	GetMomental(ctx context.Context, currency string, moment, asOf time.Time) (decimal.Decimal, error)
+	Export(ctx context.Context, opts ExportOpts, w io.Writer) error
+	Import(ctx context.Context, format, conflictMode string, r io.Reader) (*entity.ImportReport, error)
+	Override(ctx context.Context, c entity.Correction) error
+	Void(ctx context.Context, c entity.Correction) error
+	GetVersions(ctx context.Context, key entity.Exchrate) ([]entity.RateVersion, error)
+	GetFixings(ctx context.Context, date string) ([]entity.Fixing, error)
+	GetQuality(ctx context.Context, currencies []string, from, till time.Time) (*entity.QualityReport, error)
+	GetQuarantined(ctx context.Context, status string, limit, offset uint64) ([]entity.Quarantined, error)
+	Release(ctx context.Context, id int64, review entity.Review) error
+	Discard(ctx context.Context, id int64, review entity.Review) error
+	AuthenticateKey(ctx context.Context, key string) (*entity.Principal, error)
+	CreateAPIKey(ctx context.Context, name, role string) (*entity.NewAPIKey, error)
+	GetAPIKeys(ctx context.Context) ([]entity.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int64) error
+	AddUsage(ctx context.Context, usage []entity.Usage) error
+	GetUsage(ctx context.Context, date string) ([]entity.Usage, error)
+	GetHealth(ctx context.Context) entity.Health
+	GetLeader() entity.LeaderStatus
+}
+
+type ExportOpts struct {
+	Currencies []string
+	From       time.Time
+	Till       time.Time
+	AggrType   string // empty for the raw rates
+	Format     string
+	Location   *time.Location // the times are presented and the intervals are aligned in, UTC if nil
+}
+
+// Validate checks the options that can be rejected before anything is streamed.
+func (o ExportOpts) Validate() error {
+	if len(o.Currencies) == 0 {
+		return errors.New("no currencies to export")
+	}
+	if o.AggrType != "" {
+		if _, err := aggrInterval(o.AggrType); err != nil {
+			return err
+		}
+	}
+	if !export.IsSupported(o.Format) {
+		return errors.Errorf("unsupported export format '%s'", o.Format)
+	}
+	return nil
 }
 
 type RatesService struct {
-	Name   string
-	Repo   repository.Repository
-	Poller poller.Poller
-	Conf   config.Config
+	Name       string
+	Repo       repository.Repository
+	Poller     poller.Poller
+	Conf       config.Config
+	Precisions entity.Precisions
+	Quality    quality.Config
+	Started    time.Time
+	Leadership Leadership // nil without the leader election
+}
+
+// Leadership tells whether the replica leads.
+type Leadership interface {
+	Status() entity.LeaderStatus
 }
 
-func New(conf config.Config, name string, r repository.Repository, p poller.Poller) *RatesService {
+func New(conf config.Config, name string, r repository.Repository, p poller.Poller, precisions entity.Precisions, q quality.Config) *RatesService {
 	return &RatesService{
-		Name:   name,
-		Repo:   r,
-		Poller: p,
-		Conf:   conf,
+		Name:       name,
+		Repo:       r,
+		Poller:     p,
+		Conf:       conf,
+		Precisions: precisions,
+		Quality:    q,
+		Started:    time.Now(),
 	}
 }
 
@@ -47,66 +114,445 @@ func (s *RatesService) StopPolling() {
 	s.Poller.Stop()
 }
 
-func (s *RatesService) GetStatus(ctx context.Context, currency string) ([]float64, error) {
-	var res []float64
+// GetStatus returns the last rate, followed by the day, week and month averages, all rounded to the precision of the pair.
+func (s *RatesService) GetStatus(ctx context.Context, currency string) (_ []decimal.Decimal, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetStatus", attribute.String("currency", currency))
+	defer func() { tracing.End(span, err) }()
 
-	lastRate, err := s.GetMomental(ctx, currency, time.Now())
+	spans := []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, time.Duration(daysLastMonth()) * 24 * time.Hour}
+	rates, err := s.Repo.GetStatus(ctx, currency, entity.DefaultQuote, time.Now(), spans)
 	if err != nil {
 		return nil, err
 	}
-	res = append(res, lastRate)
-
-	spans := []int{1, 7, daysLastMonth()}
-	for _, span := range spans {
-		now := time.Now()
-		numDays := time.Duration(span)
-		from := now.Add(-24 * time.Hour * numDays)
-		avgRate, err := s.Repo.GetAverage(ctx, currency, from, now)
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, avgRate)
 
+	precision := s.precisionOf(currency)
+	for i := range rates {
+		rates[i] = precision.Round(rates[i])
 	}
-
-	return res, nil
+	return rates, nil
 }
 
-func (s *RatesService) GetHistory(ctx context.Context, currency string, from, till time.Time, aggrType string, limit, offset uint64) ([]string, int, error) {
-	var seconds uint64
-	var timeFormat string
-	switch strings.ToLower(aggrType) {
-	case entity.Aggr1Min:
-		seconds, timeFormat = minute*1, "02-01-2006 15:04"
-	case entity.Aggr5Min:
-		seconds, timeFormat = minute*5, "02-01-2006 15:04"
-	case entity.Aggr1Hour:
-		seconds, timeFormat = minute*60, "02-01-2006 15"
-	case entity.Aggr1Day:
-		seconds, timeFormat = minute*60*24, "02-01-2006"
-	default:
-		return nil, 0, errors.Errorf("unsupported aggrType '%s'", aggrType)
+// GetHistory returns the average rates of the intervals of the aggregation type, aligned in and presented in loc.
+// If asOf is set, the averages are of the rates known at asOf. Unless fill is none or empty, the intervals without
+// rates are filled in and the page is counted in intervals of the whole range.
+func (s *RatesService) GetHistory(ctx context.Context, currency string, from, till time.Time, aggrType string, loc *time.Location, asOf time.Time, fill string, limit, offset uint64) (_ []entity.Average, _ int, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetHistory", attribute.String("currency", currency), attribute.String("aggr_type", aggrType))
+	defer func() { tracing.End(span, err) }()
+
+	seconds, err := aggrInterval(aggrType)
+	if err != nil {
+		return nil, 0, err
+	}
+	if fill != "" && !entity.IsFillMode(fill) {
+		return nil, 0, errors.Errorf("unsupported fill '%s'", fill)
 	}
 
 	opts := repository.RatesQueryOpts{
 		Currency:          currency,
+		Quote:             entity.DefaultQuote,
 		From:              from,
 		Till:              till,
 		Limit:             limit,
 		Offset:            offset,
 		SecondsInInterval: seconds,
+		Location:          loc,
+		AsOf:              asOf,
+		Fill:              fill,
 	}
 
 	averages, total, err := s.Repo.GetHistory(ctx, opts)
 	if err != nil {
-		return nil, 0, errors.New("getting history")
+		return nil, 0, errors.Wrap(err, "getting history")
+	}
+
+	precision := s.precisionOf(currency)
+	for i := range averages {
+		if averages[i].Rate.Valid {
+			averages[i].Rate.Decimal = precision.Round(averages[i].Rate.Decimal)
+		}
+	}
+	return averages, total, nil
+}
+
+// GetMomental returns the last rate at the moment, rounded to the precision of the pair, since the rates of
+// several sources at that time are averaged. If asOf is set, the rate is the one known at asOf.
+func (s *RatesService) GetMomental(ctx context.Context, currency string, moment, asOf time.Time) (_ decimal.Decimal, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetMomental", attribute.String("currency", currency))
+	defer func() { tracing.End(span, err) }()
+
+	rate, err := s.Repo.GetMomental(ctx, currency, entity.DefaultQuote, moment, asOf)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	return s.precisionOf(currency).Round(rate), nil
+}
+
+// Export streams the raw or aggregated rates to w in the requested format.
+// Once the first row is written, a failure leaves w with a truncated output.
+func (s *RatesService) Export(ctx context.Context, opts ExportOpts, w io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Export", attribute.String("format", opts.Format))
+	defer func() { tracing.End(span, err) }()
+
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	var seconds uint64
+	if opts.AggrType != "" {
+		seconds, _ = aggrInterval(opts.AggrType)
+	}
+
+	enc, err := export.NewEncoder(opts.Format, w, seconds > 0)
+	if err != nil {
+		return err
 	}
 
-	return toStrings(timeFormat, averages), total, nil
+	qOpts := repository.ExportQueryOpts{
+		Currencies:        opts.Currencies,
+		Quote:             entity.DefaultQuote,
+		From:              opts.From,
+		Till:              opts.Till,
+		SecondsInInterval: seconds,
+		Location:          opts.Location,
+	}
+	if seconds > 0 {
+		err = s.Repo.StreamBuckets(ctx, qOpts, func(b entity.Bucket) error {
+			b.Average = s.precisionOf(b.Currency).Round(b.Average)
+			return enc.EncodeBucket(b)
+		})
+	} else {
+		loc := opts.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		err = s.Repo.StreamExchrates(ctx, qOpts, func(e entity.Exchrate) error {
+			e.Time, e.CreatedAt = e.Time.In(loc), e.CreatedAt.In(loc)
+			return enc.EncodeExchrate(e)
+		})
+	}
+	if err != nil {
+		return errors.Wrap(err, "exporting rates")
+	}
+	return enc.Close()
 }
 
-func (s *RatesService) GetMomental(ctx context.Context, currency string, moment time.Time) (float64, error) {
-	return s.Repo.GetMomental(ctx, currency, moment)
+// Import validates the rows of a csv or ndjson file and stores the valid ones in batches.
+// The report lists every rejected line with the reason. With the 'error' conflict mode
+// nothing is stored if any of the rates already exists.
+func (s *RatesService) Import(ctx context.Context, format, conflictMode string, r io.Reader) (_ *entity.ImportReport, err error) {
+	ctx, span := tracing.Start(ctx, "service.Import", attribute.String("format", format), attribute.String("conflict", conflictMode))
+	defer func() { tracing.End(span, err) }()
+
+	if !entity.IsConflictMode(conflictMode) {
+		return nil, errors.Errorf("unsupported conflict mode '%s'", conflictMode)
+	}
+	dec, err := importer.NewDecoder(format, r)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &entity.ImportReport{}
+	next := func() ([]repository.ImportRow, error) {
+		batch := make([]repository.ImportRow, 0, importBatchSize)
+		for len(batch) < importBatchSize {
+			row, err := dec.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			report.Total++
+			if row.Err != nil {
+				report.Reject(row.Line, row.Err.Error())
+				continue
+			}
+			batch = append(batch, repository.ImportRow{Line: row.Line, Exchrate: row.Exchrate})
+		}
+		if len(batch) == 0 {
+			return nil, io.EOF
+		}
+		return batch, nil
+	}
+
+	res, err := s.Repo.ImportExchrates(ctx, conflictMode, next)
+	report.Rejected = append(report.Rejected, res.Rejected...)
+	sort.Slice(report.Rejected, func(i, j int) bool { return report.Rejected[i].Line < report.Rejected[j].Line })
+	if err != nil {
+		if err == repository.ErrConflict {
+			return report, err
+		}
+		return nil, errors.Wrap(err, "importing rates")
+	}
+	report.Inserted = res.Inserted
+	report.Updated = res.Updated
+	report.Accepted = res.Inserted + res.Updated
+	return report, nil
+}
+
+// Override sets the value of a stored rate, or adds a rate, recording the correction in the audit trail of the rate.
+func (s *RatesService) Override(ctx context.Context, c entity.Correction) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Override", attribute.String("currency", c.Currency))
+	defer func() { tracing.End(span, err) }()
+
+	c = normalizeCorrection(c)
+	if err := c.Validate(entity.VersionOverride); err != nil {
+		return err
+	}
+	return s.Repo.OverrideExchrate(ctx, c)
+}
+
+// Void removes a stored rate from the queries, recording the correction in the audit trail of the rate.
+func (s *RatesService) Void(ctx context.Context, c entity.Correction) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Void", attribute.String("currency", c.Currency))
+	defer func() { tracing.End(span, err) }()
+
+	c = normalizeCorrection(c)
+	if err := c.Validate(entity.VersionVoid); err != nil {
+		return err
+	}
+	return s.Repo.VoidExchrate(ctx, c)
+}
+
+// GetVersions returns the audit trail of a rate, identified by its time, pair and source.
+func (s *RatesService) GetVersions(ctx context.Context, key entity.Exchrate) (_ []entity.RateVersion, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetVersions", attribute.String("currency", key.Currency))
+	defer func() { tracing.End(span, err) }()
+
+	key.Currency, key.Quote = strings.ToUpper(key.Currency), strings.ToUpper(key.Quote)
+	if key.Quote == "" {
+		key.Quote = entity.DefaultQuote
+	}
+	return s.Repo.GetExchrateVersions(ctx, key)
+}
+
+// GetFixings returns the daily fixings of the date, given as '2006-01-02'.
+func (s *RatesService) GetFixings(ctx context.Context, date string) (_ []entity.Fixing, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetFixings", attribute.String("date", date))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := time.Parse(entity.DateFormat, date); err != nil {
+		return nil, errors.Errorf("invalid date '%s'", date)
+	}
+	return s.Repo.GetFixings(ctx, date)
+}
+
+// GetQuality reports the gaps, duplicates, jumps, stale runs and poll errors of the raw rates of the currencies
+// within [from, till]. All of the polled currencies are checked if none are given.
+func (s *RatesService) GetQuality(ctx context.Context, currencies []string, from, till time.Time) (_ *entity.QualityReport, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetQuality", attribute.StringSlice("currencies", currencies))
+	defer func() { tracing.End(span, err) }()
+
+	if len(currencies) == 0 {
+		currencies = s.Conf.PollerBaseCurrencies
+	}
+	if len(currencies) == 0 {
+		return nil, errors.New("no currencies to check")
+	}
+	if !till.After(from) {
+		return nil, errors.New("the range to check is empty")
+	}
+	upper := make([]string, len(currencies))
+	for i, c := range currencies {
+		upper[i] = strings.ToUpper(c)
+	}
+	return quality.Check(ctx, s.Repo, s.Quality, upper, from, till)
+}
+
+// GetQuarantined returns the polled rates held back as suspicious in the status, all of them if status is empty.
+func (s *RatesService) GetQuarantined(ctx context.Context, status string, limit, offset uint64) (_ []entity.Quarantined, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetQuarantined", attribute.String("status", status))
+	defer func() { tracing.End(span, err) }()
+
+	if status != "" && !entity.IsQuarantineStatus(status) {
+		return nil, errors.Errorf("unsupported status '%s'", status)
+	}
+	return s.Repo.GetQuarantined(ctx, status, limit, offset)
+}
+
+// Release stores a quarantined rate as it was polled.
+func (s *RatesService) Release(ctx context.Context, id int64, review entity.Review) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Release", attribute.Int64("id", id))
+	defer func() { tracing.End(span, err) }()
+
+	if err := review.Validate(); err != nil {
+		return err
+	}
+	return s.Repo.ReleaseQuarantined(ctx, id, review)
+}
+
+// Discard drops a quarantined rate for good.
+func (s *RatesService) Discard(ctx context.Context, id int64, review entity.Review) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Discard", attribute.Int64("id", id))
+	defer func() { tracing.End(span, err) }()
+
+	if err := review.Validate(); err != nil {
+		return err
+	}
+	return s.Repo.DiscardQuarantined(ctx, id, review)
+}
+
+// AuthenticateKey returns the client of the API key, nil if the key is unknown or revoked.
+func (s *RatesService) AuthenticateKey(ctx context.Context, key string) (_ *entity.Principal, err error) {
+	ctx, span := tracing.Start(ctx, "service.AuthenticateKey")
+	defer func() { tracing.End(span, err) }()
+
+	k, err := s.Repo.GetAPIKeyByHash(ctx, entity.HashAPIKey(key))
+	if err == repository.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entity.Principal{Name: k.Name, Role: k.Role, KeyID: k.ID}, nil
+}
+
+// CreateAPIKey makes a new key of the role for the client. The key is returned only here, as it is stored hashed.
+func (s *RatesService) CreateAPIKey(ctx context.Context, name, role string) (_ *entity.NewAPIKey, err error) {
+	ctx, span := tracing.Start(ctx, "service.CreateAPIKey", attribute.String("role", role))
+	defer func() { tracing.End(span, err) }()
+
+	k := entity.APIKey{Name: strings.TrimSpace(name), Role: role}
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	secret, err := entity.NewAPIKeySecret()
+	if err != nil {
+		return nil, err
+	}
+	k.Prefix = entity.KeyPrefix(secret)
+
+	k, err = s.Repo.AddAPIKey(ctx, k, entity.HashAPIKey(secret))
+	if err != nil {
+		return nil, err
+	}
+	return &entity.NewAPIKey{APIKey: k, Key: secret}, nil
+}
+
+func (s *RatesService) GetAPIKeys(ctx context.Context) (_ []entity.APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetAPIKeys")
+	defer func() { tracing.End(span, err) }()
+
+	return s.Repo.GetAPIKeys(ctx)
+}
+
+func (s *RatesService) RevokeAPIKey(ctx context.Context, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "service.RevokeAPIKey", attribute.Int64("id", id))
+	defer func() { tracing.End(span, err) }()
+
+	return s.Repo.RevokeAPIKey(ctx, id)
+}
+
+func (s *RatesService) AddUsage(ctx context.Context, usage []entity.Usage) (err error) {
+	ctx, span := tracing.Start(ctx, "service.AddUsage", attribute.Int("clients", len(usage)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.Repo.AddUsage(ctx, usage)
+}
+
+// GetUsage returns the requests made, the cost spent and the requests turned down per client on the day (UTC).
+func (s *RatesService) GetUsage(ctx context.Context, date string) (_ []entity.Usage, err error) {
+	ctx, span := tracing.Start(ctx, "service.GetUsage", attribute.String("date", date))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := time.Parse(entity.DateFormat, date); err != nil {
+		return nil, errors.Errorf("invalid date '%s'", date)
+	}
+	return s.Repo.GetUsage(ctx, date)
+}
+
+// GetHealth checks that the db can be reached, that all of the migrations are applied to it and that the poller
+// was not stopped by an error. A poller stopped on purpose is healthy.
+func (s *RatesService) GetHealth(ctx context.Context) entity.Health {
+	ctx, span := tracing.Start(ctx, "service.GetHealth")
+	defer span.End()
+
+	h := entity.Health{
+		Status:  entity.HealthUp,
+		Checked: time.Now(),
+		Uptime:  time.Since(s.Started).Round(time.Second).String(),
+	}
+
+	h.Add(check("database", func() (string, error) {
+		return "", s.Repo.Ping(ctx)
+	}))
+	h.Add(check("migrations", func() (string, error) {
+		statuses, err := s.Repo.MigrateStatus()
+		if err != nil {
+			return "", err
+		}
+		var pending []string
+		for _, st := range statuses {
+			if st.AppliedAt == nil {
+				pending = append(pending, st.ID)
+			}
+		}
+		if len(pending) > 0 {
+			return "", errors.Errorf("pending migrations: %s", strings.Join(pending, ", "))
+		}
+		return fmt.Sprintf("%d applied", len(statuses)), nil
+	}))
+	if s.Poller != nil {
+		h.Add(check("poller", func() (string, error) {
+			state := s.Poller.State()
+			if state.State == entity.PollerFailed {
+				return "", errors.Errorf("failed at %s: %s", state.Since.Format(time.RFC3339), state.Error)
+			}
+			return state.State, nil
+		}))
+	}
+	return h
+}
+
+// GetLeader tells whether the replica is the one that polls. Without the leader election, every replica is.
+func (s *RatesService) GetLeader() entity.LeaderStatus {
+	if s.Leadership == nil {
+		return entity.LeaderStatus{Leader: true, Identity: entity.ReplicaIdentity()}
+	}
+	return s.Leadership.Status()
+}
+
+// check runs the check of a dependency, timing it
+func check(name string, fn func() (string, error)) entity.Check {
+	start := time.Now()
+	detail, err := fn()
+	c := entity.Check{
+		Name:      name,
+		Status:    entity.HealthUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Detail:    detail,
+	}
+	if err != nil {
+		c.Status, c.Detail = entity.HealthDown, err.Error()
+	}
+	return c
+}
+
+func normalizeCorrection(c entity.Correction) entity.Correction {
+	c.Currency, c.Quote = strings.ToUpper(c.Currency), strings.ToUpper(c.Quote)
+	if c.Quote == "" {
+		c.Quote = entity.DefaultQuote
+	}
+	return c
+}
+
+// precisionOf returns the precision of the currency against the default quote, which the queries are made in.
+func (s *RatesService) precisionOf(currency string) entity.Precision {
+	return s.Precisions.Of(currency, entity.DefaultQuote)
+}
+
+func aggrInterval(aggrType string) (uint64, error) {
+	switch strings.ToLower(aggrType) {
+	case entity.Aggr1Min:
+		return minute * 1, nil
+	case entity.Aggr5Min:
+		return minute * 5, nil
+	case entity.Aggr1Hour:
+		return minute * 60, nil
+	case entity.Aggr1Day:
+		return minute * 60 * 24, nil
+	default:
+		return 0, errors.Errorf("unsupported aggrType '%s'", aggrType)
+	}
 }
 
 func daysLastMonth() int {
@@ -114,11 +560,3 @@ func daysLastMonth() int {
 	t2 := t.AddDate(0, -1, 0)
 	return -int(math.Round(t2.Sub(t).Hours() / 24))
 }
-
-func toStrings(timeFormat string, averages []entity.Average) []string {
-	var arr []string
-	for _, a := range averages {
-		arr = append(arr, a.String(timeFormat))
-	}
-	return arr
-}
@@ -6,11 +6,15 @@ import (
 	"github.com/nettyrnp/exch-rates/api/common"
 	"github.com/nettyrnp/exch-rates/config"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/require"
 
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/sys/quality"
 	"github.com/nettyrnp/exch-rates/api/sys/repository"
 )
 
@@ -24,16 +28,20 @@ func TestService(t *testing.T) {
 
 	t.Run("get momental", testGetMomental(repo))
 	t.Run("get history", testGetHistory(repo))
+	t.Run("averages over the rollups", testRollupAverages(repo))
+	t.Run("import", testImport(repo))
+	// purges the raw rates, so it goes last
+	t.Run("averages after the compaction", testCompactedAverages(repo))
 }
 
 func testGetMomental(repo *repository.RDBMSRepository) func(t *testing.T) {
 	return func(t *testing.T) {
-		svc := New(config.Config{}, "", repo, nil)
+		svc := New(config.Config{}, "", repo, nil, entity.Precisions{}, quality.Config{})
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
 
-		t1, _ := common.ParseTime("2020-03-22 15:08:29")
-		rate1, err := svc.GetMomental(ctx, "USD", t1)
+		t1, _ := common.ParseTime("2020-03-22T15:08:29Z", time.UTC)
+		rate1, err := svc.GetMomental(ctx, "USD", t1, time.Time{})
 		require.NoError(t, err)
 		assert.Len(t, rate1, 5)
 
@@ -47,3 +55,199 @@ func testGetHistory(repo *repository.RDBMSRepository) func(t *testing.T) {
 		// ...
 	}
 }
+
+func testImport(repo *repository.RDBMSRepository) func(t *testing.T) {
+	return func(t *testing.T) {
+		svc := New(config.Config{}, "", repo, nil, entity.Precisions{Default: entity.Precision{Scale: 6}}, quality.Config{})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		day := time.Date(2020, 3, 27, 0, 0, 0, 0, time.UTC)
+		momental := func(at time.Time) decimal.Decimal {
+			rate, err := svc.GetMomental(ctx, "CHF", at, time.Time{})
+			require.NoError(t, err)
+			return rate
+		}
+		lines := func(rows []entity.RejectedRow) []int {
+			res := make([]int, len(rows))
+			for i, r := range rows {
+				res[i] = r.Line
+			}
+			return res
+		}
+		csv := func(rows ...string) *strings.Reader {
+			return strings.NewReader("time,base,quote,rate,source\n" + strings.Join(rows, "\n") + "\n")
+		}
+
+		report, err := svc.Import(ctx, "csv", entity.ConflictError, csv(
+			"2020-03-27T10:00:00Z,CHF,RUB,80.1,a",
+			"2020-03-27T11:00:00Z,CHF,RUB,80.2,a",
+			"2020-03-27T11:00:00Z,CHF,RUB,80.3,a",
+			"bad,CHF,RUB,80.4,a",
+			"2020-03-27T11:00:00Z,CHF,USD,0.97,a",
+		))
+		require.NoError(t, err)
+		assert.Equal(t, 5, report.Total)
+		assert.Equal(t, 2, report.Inserted)
+		assert.Equal(t, []int{4, 5, 6}, lines(report.Rejected))
+		assert.Equal(t, "duplicate of line 3", report.Rejected[0].Reason)
+
+		// a conflict stores nothing
+		report, err = svc.Import(ctx, "csv", entity.ConflictError, csv(
+			"2020-03-27T10:00:00Z,CHF,RUB,81,a",
+			"2020-03-27T12:00:00Z,CHF,RUB,80.5,a",
+		))
+		assert.Equal(t, repository.ErrConflict, err)
+		require.NotNil(t, report)
+		assert.Equal(t, []int{2}, lines(report.Rejected))
+		assert.True(t, decimal.RequireFromString("80.2").Equal(momental(day.Add(12*time.Hour+30*time.Minute))))
+
+		report, err = svc.Import(ctx, "csv", entity.ConflictSkip, csv(
+			"2020-03-27T10:00:00Z,CHF,RUB,81,a",
+			"2020-03-27T12:00:00Z,CHF,RUB,80.5,a",
+		))
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Inserted)
+		assert.Equal(t, 0, report.Updated)
+		assert.Equal(t, []int{2}, lines(report.Rejected))
+		assert.True(t, decimal.RequireFromString("80.1").Equal(momental(day.Add(10*time.Hour+30*time.Minute))))
+		assert.True(t, decimal.RequireFromString("80.5").Equal(momental(day.Add(12*time.Hour+30*time.Minute))))
+
+		report, err = svc.Import(ctx, "csv", entity.ConflictOverwrite, csv(
+			"2020-03-27T10:00:00Z,CHF,RUB,81,a",
+			"2020-03-27T13:00:00Z,CHF,RUB,80.6,a",
+		))
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Inserted)
+		assert.Equal(t, 1, report.Updated)
+		assert.Empty(t, report.Rejected)
+		assert.True(t, decimal.RequireFromString("81").Equal(momental(day.Add(10*time.Hour+30*time.Minute))))
+
+		got, err := repo.GetAverage(ctx, "CHF", entity.DefaultQuote, day, day.Add(24*time.Hour))
+		require.NoError(t, err)
+		assertRate(t, decimal.RequireFromString("80.575"), got)
+	}
+}
+
+var gbpDay = time.Date(2020, 3, 25, 0, 0, 0, 0, time.UTC)
+
+// gbpRates are two days of GBP/RUB rates of a source polled every 10 minutes and of another one polled every hour,
+// along with GBP/USD rates that the reads of GBP/RUB must leave out.
+func gbpRates() []entity.Exchrate {
+	var es []entity.Exchrate
+	for i := 0; i < 288; i++ {
+		tm := gbpDay.Add(time.Duration(i) * 10 * time.Minute)
+		es = append(es, entity.Exchrate{Time: tm, Currency: "GBP", Quote: "RUB", Source: "often",
+			Rate: decimal.New(1000+int64(i%7), -1)})
+		if i%6 == 0 {
+			es = append(es, entity.Exchrate{Time: tm, Currency: "GBP", Quote: "RUB", Source: "hourly",
+				Rate: decimal.New(510+int64(i/6%5), -1).Mul(decimal.New(2, 0))})
+			es = append(es, entity.Exchrate{Time: tm, Currency: "GBP", Quote: "USD", Source: "hourly",
+				Rate: decimal.New(13, -1)})
+		}
+	}
+	return es
+}
+
+// sourceMean averages the GBP/RUB rates within [from, till] per source and then the sources, as the reads do.
+func sourceMean(es []entity.Exchrate, from, till time.Time) decimal.Decimal {
+	sums, counts := map[string]decimal.Decimal{}, map[string]int64{}
+	for _, e := range es {
+		if e.Quote != "RUB" || e.Time.Before(from) || e.Time.After(till) {
+			continue
+		}
+		sums[e.Source] = sums[e.Source].Add(e.Rate)
+		counts[e.Source]++
+	}
+	var total decimal.Decimal
+	for source, sum := range sums {
+		total = total.Add(sum.Div(decimal.NewFromInt(counts[source])))
+	}
+	return total.Div(decimal.NewFromInt(int64(len(sums))))
+}
+
+func assertRate(t *testing.T, want, got decimal.Decimal, msgAndArgs ...interface{}) {
+	t.Helper()
+	assert.True(t, want.Sub(got).Abs().LessThan(decimal.New(1, -9)), append([]interface{}{"want %v, got %v", want, got}, msgAndArgs...)...)
+}
+
+// assertAverages compares the averages read, mostly from the rollups, with the ones of the raw rates
+func assertAverages(t *testing.T, repo *repository.RDBMSRepository, es []entity.Exchrate) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ranges := [][2]time.Time{
+		{gbpDay, gbpDay.Add(48 * time.Hour)},                                                  // whole days
+		{gbpDay.Add(10*time.Hour + 5*time.Minute), gbpDay.Add(37*time.Hour + 30*time.Minute)}, // hours, minutes and raw rates
+		{gbpDay.Add(3*time.Hour + 20*time.Minute), gbpDay.Add(3*time.Hour + 40*time.Minute)},  // minutes only
+	}
+	for _, r := range ranges {
+		got, err := repo.GetAverage(ctx, "GBP", "RUB", r[0], r[1])
+		require.NoError(t, err)
+		assertRate(t, sourceMean(es, r[0], r[1]), got, "average from %v till %v", r[0], r[1])
+	}
+
+	averages, _, err := repo.GetHistory(ctx, repository.RatesQueryOpts{
+		Currency:          "GBP",
+		Quote:             "RUB",
+		From:              gbpDay,
+		Till:              gbpDay.Add(48*time.Hour - time.Second),
+		Limit:             100,
+		SecondsInInterval: 3600,
+	})
+	require.NoError(t, err)
+	require.Len(t, averages, 48)
+	for _, a := range averages {
+		want := sourceMean(es, a.Time, a.Time.Add(time.Hour-time.Nanosecond))
+		require.True(t, a.Rate.Valid)
+		assertRate(t, want, a.Rate.Decimal, "hour of %v", a.Time)
+	}
+
+	rates, err := repo.GetStatus(ctx, "GBP", "RUB", gbpDay.Add(48*time.Hour), []time.Duration{24 * time.Hour})
+	require.NoError(t, err)
+	last := gbpDay.Add(47*time.Hour + 50*time.Minute)
+	assertRate(t, sourceMean(es, last, last), rates[0], "the last rate")
+	assertRate(t, sourceMean(es, gbpDay.Add(24*time.Hour), gbpDay.Add(48*time.Hour)), rates[1], "the day average")
+}
+
+func testRollupAverages(repo *repository.RDBMSRepository) func(t *testing.T) {
+	return func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		es := gbpRates()
+		require.NoError(t, repo.AddExchrates(ctx, es))
+		assertAverages(t, repo, es)
+	}
+}
+
+func testCompactedAverages(repo *repository.RDBMSRepository) func(t *testing.T) {
+	return func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		retention := repo.Cfg.Retention
+		defer func() { repo.Cfg.Retention = retention }()
+		repo.Cfg.Retention = repository.RetentionPolicy{Raw: 24 * time.Hour}
+
+		// the raw GBP rates are purged, the rollups keep them
+		purged, err := repo.Compact(ctx, gbpDay.Add(72*time.Hour+12*time.Hour))
+		require.NoError(t, err)
+		assert.True(t, purged)
+		purged, err = repo.Compact(ctx, gbpDay.Add(72*time.Hour+12*time.Hour))
+		require.NoError(t, err)
+		assert.False(t, purged, "nothing is left to purge")
+		es := gbpRates()
+		got, err := repo.GetAverage(ctx, "GBP", "RUB", gbpDay, gbpDay.Add(48*time.Hour))
+		require.NoError(t, err)
+		assertRate(t, sourceMean(es, gbpDay, gbpDay.Add(48*time.Hour)), got)
+
+		// the rates written into the purged days are added to their buckets
+		late := entity.Exchrate{Time: gbpDay.Add(30 * time.Minute), Currency: "GBP", Quote: "RUB", Source: "often", Rate: decimal.New(110, 0)}
+		require.NoError(t, repo.AddExchrate(ctx, &late))
+		end := gbpDay.Add(24*time.Hour - time.Second)
+		got, err = repo.GetAverage(ctx, "GBP", "RUB", gbpDay, end)
+		require.NoError(t, err)
+		assertRate(t, sourceMean(append(es, late), gbpDay, end), got)
+	}
+}
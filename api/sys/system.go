@@ -1,14 +1,25 @@
 package sys
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 
 	"github.com/nettyrnp/exch-rates/api/common"
+	"github.com/nettyrnp/exch-rates/api/middleware"
+	"github.com/nettyrnp/exch-rates/api/sys/anomaly"
+	"github.com/nettyrnp/exch-rates/api/sys/cache"
+	"github.com/nettyrnp/exch-rates/api/sys/compactor"
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/sys/fixer"
 	"github.com/nettyrnp/exch-rates/api/sys/http"
+	"github.com/nettyrnp/exch-rates/api/sys/leader"
 	"github.com/nettyrnp/exch-rates/api/sys/poller"
+	"github.com/nettyrnp/exch-rates/api/sys/quality"
 	"github.com/nettyrnp/exch-rates/api/sys/repository"
 	"github.com/nettyrnp/exch-rates/api/sys/service"
 	"github.com/nettyrnp/exch-rates/config"
@@ -18,8 +29,9 @@ func NewRepository(conf config.Config, kind string) *repository.RDBMSRepository
 	repo := &repository.RDBMSRepository{
 		Name: kind,
 		Cfg: repository.Config{
-			Driver: conf.RepositoryDriver,
-			DSN:    conf.RepositoryDSN,
+			Driver:    conf.RepositoryDriver,
+			DSN:       conf.RepositoryDSN,
+			Retention: RetentionPolicy(conf),
 		},
 	}
 
@@ -36,9 +48,15 @@ func NewPoller(conf config.Config, repo *repository.RDBMSRepository) *poller.Rat
 		Cfg: poller.Config{
 			Currencies: conf.PollerBaseCurrencies,
 			URL:        conf.PollerURL,
+			Interval:   conf.PollerInterval,
 			Timeout:    conf.PollerTimeout,
+			Source:     conf.PollerSource,
 		},
-		Repo:    repo,
+		Writer: poller.NewBatchWriter(repo, conf.PollerBatchSize, conf.PollerFlushInterval, conf.PollerTimeout, func(err error) {
+			common.LogError(err.Error())
+		}),
+		Journal: repo,
+		Guard:   NewGuard(conf, repo),
 		Ticker:  time.NewTicker(conf.PollerInterval),
 		Done:    make(chan bool),
 		ErrorCh: make(chan error),
@@ -46,24 +64,243 @@ func NewPoller(conf config.Config, repo *repository.RDBMSRepository) *poller.Rat
 	return a
 }
 
+func NewGuard(conf config.Config, repo *repository.RDBMSRepository) *anomaly.Guard {
+	return anomaly.New(anomaly.Config{
+		Threshold:    conf.AnomalyThreshold,
+		Alpha:        conf.AnomalyAlpha,
+		Warmup:       conf.AnomalyWarmup,
+		MinDeviation: conf.AnomalyMinDeviation,
+		Patience:     conf.AnomalyPatience,
+	}, repo)
+}
+
+func RetentionPolicy(conf config.Config) repository.RetentionPolicy {
+	return repository.RetentionPolicy{
+		Raw:    conf.RetentionRaw,
+		Minute: conf.Retention1Min,
+		Hour:   conf.Retention1Hour,
+	}
+}
+
+func Precisions(conf config.Config) entity.Precisions {
+	def := entity.Precision{Scale: int32(conf.RateScale), Rounding: conf.RateRounding}
+	precisions, err := entity.ParsePrecisions(def, conf.RatePrecisions)
+	if err != nil {
+		common.LogError(errors.Wrap(err, "parsing rate precisions").Error())
+		os.Exit(1)
+	}
+	return precisions
+}
+
+func NewCompactor(conf config.Config, repo *repository.RDBMSRepository) *compactor.Compactor {
+	return compactor.New(compactor.Config{
+		Interval: conf.CompactionInterval,
+		Timeout:  conf.CompactionTimeout,
+	}, repo)
+}
+
+func NewFixer(conf config.Config, repo *repository.RDBMSRepository) *fixer.Fixer {
+	specs, err := entity.ParseFixingSpecs(conf.Fixings)
+	if err != nil {
+		common.LogError(errors.Wrap(err, "parsing fixings").Error())
+		os.Exit(1)
+	}
+	return fixer.New(fixer.Config{
+		Interval: conf.FixingInterval,
+		Delay:    conf.FixingDelay,
+		Timeout:  conf.FixingTimeout,
+	}, repo, specs, Precisions(conf))
+}
+
+func QualityConfig(conf config.Config) quality.Config {
+	return quality.Config{
+		PollerInterval: conf.PollerInterval,
+		MaxJump:        decimal.NewFromFloat(conf.QualityMaxJump),
+		StaleCount:     conf.QualityStaleCount,
+	}
+}
+
+func NewQualityChecker(conf config.Config, repo *repository.RDBMSRepository) *quality.Checker {
+	return quality.NewChecker(quality.CheckerConfig{
+		Interval:   conf.QualityInterval,
+		Timeout:    conf.QualityTimeout,
+		Currencies: conf.PollerBaseCurrencies,
+	}, QualityConfig(conf), repo)
+}
+
+// lockStore hands out the leadership as an advisory lock of the db
+type lockStore struct {
+	repo *repository.RDBMSRepository
+}
+
+func (s lockStore) TryLock(ctx context.Context, key int64) (leader.Lock, error) {
+	lock, err := s.repo.TryAdvisoryLock(ctx, key)
+	if lock == nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// intentStore shares the poller intent of the replicas electing their leader by the key through the db
+type intentStore struct {
+	repo *repository.RDBMSRepository
+	key  int64
+}
+
+func (s intentStore) Wanted(ctx context.Context) (bool, error) {
+	return s.repo.PollerWanted(ctx, s.key)
+}
+
+func (s intentStore) SetWanted(ctx context.Context, wanted bool) error {
+	return s.repo.SetPollerWanted(ctx, s.key, wanted)
+}
+
+func NewElector(conf config.Config, repo *repository.RDBMSRepository, follower leader.Follower) *leader.Elector {
+	return leader.New(leader.Config{
+		Key:      conf.LeaderLockKey,
+		Interval: conf.LeaderInterval,
+		Timeout:  conf.LeaderTimeout,
+		Identity: entity.ReplicaIdentity(),
+	}, lockStore{repo}, follower)
+}
+
+// Module is the controller of the service along with the parts of it that run in the background.
+type Module struct {
+	Controller *http.Controller
+	Limiter    *middleware.Limiter
+
+	repo      *repository.RDBMSRepository
+	poller    *poller.RatesPoller
+	compactor *compactor.Compactor
+	fixer     *fixer.Fixer
+	checker   *quality.Checker
+	elector   *leader.Elector            // nil without the leader election
+	changes   *repository.ChangeListener // nil if the db could not be listened to
+}
+
 // todo: remove kind
-func NewController(conf config.Config, kind string) *http.Controller {
+func NewModule(conf config.Config, kind string) *Module {
 	repo := NewRepository(conf, kind)
 
 	pollr := NewPoller(conf, repo)
 
-	svc := service.New(conf, kind, repo, pollr)
+	m := &Module{
+		repo:      repo,
+		poller:    pollr,
+		compactor: NewCompactor(conf, repo),
+		fixer:     NewFixer(conf, repo),
+		checker:   NewQualityChecker(conf, repo),
+	}
+
+	rs := service.New(conf, kind, repo, pollr, Precisions(conf), QualityConfig(conf))
+	if conf.LeaderElection {
+		gate := leader.NewGate(pollr, intentStore{repo, conf.LeaderLockKey}, conf.LeaderTimeout)
+		m.elector = NewElector(conf, repo, gate)
+		rs.Poller, rs.Leadership = gate, m.elector
+	}
+	svc := cache.New(rs, conf.PollerInterval, conf.CacheMaxEntries)
+	pollr.Writer.OnStored = svc.Invalidate
+	m.compactor.OnCompacted = func() { svc.Invalidate(nil) }
+	// the other replicas, the leader among them, and the CLI write the rates as well
+	changes, err := repo.ListenChanges(func() { svc.Invalidate(nil) })
+	if err != nil {
+		common.LogError(errors.Wrap(err, "the cached reads only expire with the polls").Error())
+	}
+	m.changes = changes
+
+	// started once the cache is told of the writes
+	if m.elector != nil {
+		m.elector.Start()
+	}
+	m.compactor.Start()
+	m.fixer.Start()
+	m.checker.Start()
 
-	return http.New(svc, conf, kind)
+	m.Controller = http.New(svc, conf, kind)
+	m.Limiter = NewLimiter(m.Controller)
+	m.Limiter.Start()
+	return m
 }
 
-func Route(mux *mux.Router, c *http.Controller) {
+// Close stops the parts of the module that run in the background, letting each one complete what it is at,
+// and closes the db once none of them need it. The requests are expected to be drained before.
+func (m *Module) Close() {
+	if m.elector != nil {
+		m.elector.Stop()
+	}
+	m.poller.Stop()
+	m.compactor.Stop()
+	m.fixer.Stop()
+	m.checker.Stop()
+	m.Limiter.Stop()
+	if m.changes != nil {
+		if err := m.changes.Close(); err != nil {
+			common.LogError(errors.Wrap(err, "closing the listener of the rate changes").Error())
+		}
+	}
+
+	if err := m.repo.Close(); err != nil {
+		common.LogError(errors.Wrap(err, "closing db").Error())
+	}
+}
+
+// Authenticator resolves the clients of the requests the handlers of the controller are routed by Route.
+func Authenticator(c *http.Controller) middleware.Middleware {
+	return middleware.Authenticate(c.Service, middleware.AuthConfig{
+		Enabled:   c.Conf.AuthEnabled,
+		JWTSecret: []byte(c.Conf.AuthJWTSecret),
+	})
+}
+
+// NewLimiter limits the clients of the requests the handlers of the controller are routed by Route,
+// keeping their usage through the service.
+func NewLimiter(c *http.Controller) *middleware.Limiter {
+	return middleware.NewLimiter(middleware.RateLimitConfig{
+		Rate:         c.Conf.RateLimitRate,
+		Burst:        c.Conf.RateLimitBurst,
+		Quota:        c.Conf.QuotaDaily,
+		TrustProxy:   c.Conf.RateLimitTrustProxy,
+		FlushEvery:   c.Conf.UsageFlushInterval,
+		FlushTimeout: c.Conf.UsageFlushTimeout,
+	}, c.Service)
+}
+
+// Route registers the handlers along with the role each one requires, which is checked against the client
+// resolved by Authenticator, and the cost each one is charged to the client by the limiter. The version
+// and the probes are open to anyone.
+func Route(mux *mux.Router, c *http.Controller, limiter *middleware.Limiter) {
+	reader := middleware.Require(entity.RoleReader)
+	operator := middleware.Require(entity.RoleOperator)
+	admin := middleware.Require(entity.RoleAdmin)
+	limit := middleware.RateLimit(limiter)
+
 	mux.HandleFunc("/exchrates/admin/version", c.Version).Methods("GET")
-	mux.HandleFunc("/exchrates/admin/logs", c.Logs).Methods("GET")
-	mux.HandleFunc("/exchrates/start_poll", c.StartPolling).Methods("POST")
-	mux.HandleFunc("/exchrates/stop_poll", c.StopPolling).Methods("POST")
+	mux.HandleFunc("/exchrates/healthz", c.Healthz).Methods("GET")
+	mux.HandleFunc("/exchrates/readyz", c.Readyz).Methods("GET")
+	mux.HandleFunc("/exchrates/admin/health", operator(limit(1, c.Health))).Methods("GET")
+	mux.HandleFunc("/exchrates/admin/leader", operator(limit(1, c.Leader))).Methods("GET")
+	mux.HandleFunc("/exchrates/admin/logs", admin(limit(5, c.Logs))).Methods("GET")
+	mux.HandleFunc("/exchrates/admin/logs/tail", admin(limit(5, c.TailLogs))).Methods("GET")
+	mux.HandleFunc("/exchrates/admin/log/level", admin(limit(1, c.LogLevel))).Methods("GET")
+	mux.HandleFunc("/exchrates/admin/log/level", admin(limit(1, c.SetLogLevel))).Methods("POST")
+	mux.HandleFunc("/exchrates/admin/import", admin(limit(20, c.Import))).Methods("POST")
+	mux.HandleFunc("/exchrates/admin/keys", admin(limit(1, c.Keys))).Methods("GET")
+	mux.HandleFunc("/exchrates/admin/keys", admin(limit(1, c.CreateKey))).Methods("POST")
+	mux.HandleFunc("/exchrates/admin/keys/{id}/revoke", admin(limit(1, c.RevokeKey))).Methods("POST")
+	mux.HandleFunc("/exchrates/admin/usage", admin(limit(1, c.Usage))).Methods("GET")
+	mux.HandleFunc("/exchrates/admin/rates/override", operator(limit(1, c.Override))).Methods("POST")
+	mux.HandleFunc("/exchrates/admin/rates/void", operator(limit(1, c.Void))).Methods("POST")
+	mux.HandleFunc("/exchrates/admin/rates/versions", operator(limit(1, c.Versions))).Methods("GET")
+	mux.HandleFunc("/exchrates/admin/quarantine", operator(limit(1, c.Quarantined))).Methods("GET")
+	mux.HandleFunc("/exchrates/admin/quarantine/{id}/release", operator(limit(1, c.Release))).Methods("POST")
+	mux.HandleFunc("/exchrates/admin/quarantine/{id}/discard", operator(limit(1, c.Discard))).Methods("POST")
+	mux.HandleFunc("/exchrates/start_poll", operator(limit(1, c.StartPolling))).Methods("POST")
+	mux.HandleFunc("/exchrates/stop_poll", operator(limit(1, c.StopPolling))).Methods("POST")
 
-	mux.HandleFunc("/exchrates/status/{name}", c.Status).Methods("GET", "OPTIONS")
-	mux.HandleFunc("/exchrates/history", c.History).Methods("POST", "OPTIONS")
-	mux.HandleFunc("/exchrates/momental", c.Momental).Methods("POST", "OPTIONS")
+	mux.HandleFunc("/exchrates/status/{name}", reader(limit(1, c.Status))).Methods("GET", "OPTIONS")
+	mux.HandleFunc("/exchrates/history", reader(limit(10, c.History))).Methods("POST", "OPTIONS")
+	mux.HandleFunc("/exchrates/momental", reader(limit(2, c.Momental))).Methods("POST", "OPTIONS")
+	mux.HandleFunc("/exchrates/export", reader(limit(20, c.Export))).Methods("GET", "OPTIONS")
+	mux.HandleFunc("/exchrates/fixings/{date}", reader(limit(1, c.Fixings))).Methods("GET", "OPTIONS")
+	mux.HandleFunc("/exchrates/quality", reader(limit(20, c.Quality))).Methods("GET", "OPTIONS")
 }
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/nettyrnp/exch-rates/api/common"
-	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/urfave/cli"
 
 	"github.com/nettyrnp/exch-rates/api"
+	"github.com/nettyrnp/exch-rates/api/sys"
+	"github.com/nettyrnp/exch-rates/api/sys/entity"
+	"github.com/nettyrnp/exch-rates/api/sys/export"
+	"github.com/nettyrnp/exch-rates/api/sys/importer"
 	"github.com/nettyrnp/exch-rates/api/sys/repository"
+	"github.com/nettyrnp/exch-rates/api/sys/service"
 	"github.com/nettyrnp/exch-rates/config"
 )
 
@@ -26,17 +36,274 @@ func startCmd(flags []cli.Flag) cli.Command {
 
 			conf := config.Load(fname)
 			conf.Print(fname)
-			common.InitLogger(conf)
+			if err := common.InitLogger(conf); err != nil {
+				return err
+			}
 
 			return api.Run(conf)
 		},
 	}
 }
 
+func initRepository(c *cli.Context) (*repository.RDBMSRepository, error) {
+	fname := c.String("env")
+	if fname == "" {
+		return nil, errors.New("you must specify an environment file")
+	}
+
+	conf := config.Load(fname)
+
+	repo := &repository.RDBMSRepository{
+		Cfg: repository.Config{
+			Driver:    conf.RepositoryDriver,
+			DSN:       conf.RepositoryDSN,
+			Retention: sys.RetentionPolicy(conf),
+		},
+	}
+
+	if initErr := repo.Init(); initErr != nil {
+		return nil, initErr
+	}
+	return repo, nil
+}
+
 func migrateCmd(flags []cli.Flag) cli.Command {
 	return cli.Command{
 		Name:  "migrate",
-		Usage: "Applies db migration scripts to db specified in env file",
+		Usage: "Manages db migrations of the db specified in env file",
+		Subcommands: []cli.Command{
+			{
+				Name:      "up",
+				Usage:     "Applies N pending migrations, all of them if N is omitted",
+				ArgsUsage: "[N]",
+				Flags:     flags,
+				Action: func(c *cli.Context) error {
+					max, err := migrationsCount(c, false)
+					if err != nil {
+						return err
+					}
+					repo, err := initRepository(c)
+					if err != nil {
+						return err
+					}
+					n, err := repo.MigrateUp(max)
+					fmt.Printf("applied %d migrations\n", n)
+					return err
+				},
+			},
+			{
+				Name:      "down",
+				Usage:     "Rolls back the last N applied migrations",
+				ArgsUsage: "N",
+				Flags:     flags,
+				Action: func(c *cli.Context) error {
+					max, err := migrationsCount(c, true)
+					if err != nil {
+						return err
+					}
+					repo, err := initRepository(c)
+					if err != nil {
+						return err
+					}
+					n, err := repo.MigrateDown(max)
+					fmt.Printf("rolled back %d migrations\n", n)
+					return err
+				},
+			},
+			{
+				Name:  "redo",
+				Usage: "Rolls back the last applied migration and applies it again",
+				Flags: flags,
+				Action: func(c *cli.Context) error {
+					repo, err := initRepository(c)
+					if err != nil {
+						return err
+					}
+					return repo.MigrateRedo()
+				},
+			},
+			{
+				Name:  "status",
+				Usage: "Lists the migrations and whether they are applied",
+				Flags: flags,
+				Action: func(c *cli.Context) error {
+					repo, err := initRepository(c)
+					if err != nil {
+						return err
+					}
+					statuses, err := repo.MigrateStatus()
+					if err != nil {
+						return err
+					}
+					for _, st := range statuses {
+						applied := "pending"
+						if st.AppliedAt != nil {
+							applied = st.AppliedAt.Format(time.RFC3339)
+						}
+						fmt.Printf("%-40s %s\n", st.ID, applied)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func keysCmd(flags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "keys",
+		Usage: "Manages the API keys",
+		Subcommands: []cli.Command{
+			{
+				Name:  "create",
+				Usage: "Creates an API key of a role for a client. The key is shown only once",
+				Flags: append(flags,
+					cli.StringFlag{
+						Name:  "name, n",
+						Usage: "Name of the client",
+					},
+					cli.StringFlag{
+						Name:  "role, r",
+						Value: entity.RoleReader,
+						Usage: "Role of the client (reader, operator, admin)",
+					},
+				),
+				Action: func(c *cli.Context) error {
+					svc, err := initService(c)
+					if err != nil {
+						return err
+					}
+					key, err := svc.CreateAPIKey(context.Background(), c.String("name"), c.String("role"))
+					if err != nil {
+						return err
+					}
+					fmt.Printf("created %s key %d for %s: %s\n", key.Role, key.ID, key.Name, key.Key)
+					return nil
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "Lists the API keys",
+				Flags: flags,
+				Action: func(c *cli.Context) error {
+					svc, err := initService(c)
+					if err != nil {
+						return err
+					}
+					keys, err := svc.GetAPIKeys(context.Background())
+					if err != nil {
+						return err
+					}
+					for _, k := range keys {
+						revoked := ""
+						if k.RevokedAt != nil {
+							revoked = "revoked " + k.RevokedAt.Format(time.RFC3339)
+						}
+						fmt.Printf("%-6d %-24s %-9s %s... %s\n", k.ID, k.Name, k.Role, k.Prefix, revoked)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "revoke",
+				Usage:     "Revokes an API key",
+				ArgsUsage: "ID",
+				Flags:     flags,
+				Action: func(c *cli.Context) error {
+					id, err := strconv.ParseInt(c.Args().First(), 10, 64)
+					if err != nil {
+						return fmt.Errorf("you must specify the id of the key: %v", err)
+					}
+					svc, err := initService(c)
+					if err != nil {
+						return err
+					}
+					if err := svc.RevokeAPIKey(context.Background(), id); err != nil {
+						return err
+					}
+					fmt.Printf("revoked key %d\n", id)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func usageCmd(flags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "usage",
+		Usage: "Reports the requests, the cost and the rejected requests of the API clients on a day",
+		Flags: append(flags,
+			cli.StringFlag{
+				Name:  "date, d",
+				Usage: "Date (UTC) to report the usage of, as 2006-01-02. Today if omitted",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			date := c.String("date")
+			if date == "" {
+				date = time.Now().UTC().Format(entity.DateFormat)
+			}
+			svc, err := initService(c)
+			if err != nil {
+				return err
+			}
+			usage, err := svc.GetUsage(context.Background(), date)
+			if err != nil {
+				return err
+			}
+			for _, u := range usage {
+				fmt.Printf("%-32s requests=%-8d cost=%-8d rejected=%d\n", u.Client, u.Requests, u.Cost, u.Rejected)
+			}
+			return nil
+		},
+	}
+}
+
+func initService(c *cli.Context) (service.Service, error) {
+	fname := c.String("env")
+	if fname == "" {
+		return nil, errors.New("you must specify an environment file")
+	}
+
+	conf := config.Load(fname)
+	kind := string(entity.KindExchratesService)
+	return service.New(conf, kind, sys.NewRepository(conf, kind), nil, sys.Precisions(conf), sys.QualityConfig(conf)), nil
+}
+
+func migrationsCount(c *cli.Context, required bool) (int, error) {
+	if c.NArg() == 0 {
+		if required {
+			return 0, errors.New("you must specify the number of migrations")
+		}
+		return 0, nil
+	}
+	n, err := strconv.Atoi(c.Args().First())
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid number of migrations '%s'", c.Args().First())
+	}
+	return n, nil
+}
+
+func seedCmd(flags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "seed",
+		Usage: "Loads the demo data into the db specified in env file",
+		Flags: flags,
+		Action: func(c *cli.Context) error {
+			repo, err := initRepository(c)
+			if err != nil {
+				return err
+			}
+			return repo.Seed(context.Background())
+		},
+	}
+}
+
+func compactCmd(flags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "compact",
+		Usage: "Applies the retention policy once",
 		Flags: flags,
 		Action: func(c *cli.Context) error {
 			fname := c.String("env")
@@ -45,27 +312,239 @@ func migrateCmd(flags []cli.Flag) cli.Command {
 			}
 
 			conf := config.Load(fname)
+			kind := string(entity.KindExchratesService)
+			return sys.NewCompactor(conf, sys.NewRepository(conf, kind)).RunOnce(context.Background())
+		},
+	}
+}
 
-			repo := repository.RDBMSRepository{
-				Cfg: repository.Config{
-					Driver: conf.RepositoryDriver,
-					DSN:    conf.RepositoryDSN,
-				},
+func fixCmd(flags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "fix",
+		Usage: "Makes the daily fixings of a past date, leaving the ones already made as they are",
+		Flags: append(flags,
+			cli.StringFlag{
+				Name:  "date, d",
+				Usage: "Date to make the fixings of, as 2006-01-02",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			fname := c.String("env")
+			if fname == "" {
+				return errors.New("you must specify an environment file")
+			}
+			if c.String("date") == "" {
+				return errors.New("you must specify a date")
 			}
 
-			if initErr := repo.Init(); initErr != nil {
-				return initErr
+			conf := config.Load(fname)
+			kind := string(entity.KindExchratesService)
+			fixings, err := sys.NewFixer(conf, sys.NewRepository(conf, kind)).FixDate(context.Background(), c.String("date"))
+			if err != nil {
+				return err
 			}
+			out, _ := json.MarshalIndent(fixings, "", "  ")
+			fmt.Printf("%s\n", out)
+			return nil
+		},
+	}
+}
 
-			err := repo.MigrateDown()
+func qualityCmd(flags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "quality",
+		Usage: "Reports the gaps, duplicates, jumps, stale runs and poll errors of the raw rates for a time range",
+		Flags: append(flags,
+			cli.StringFlag{
+				Name:  "currency, c",
+				Usage: "Comma-separated list of currencies to check. The polled currencies if omitted",
+			},
+			cli.StringFlag{
+				Name:  "from",
+				Usage: "Start of the time range in RFC3339, e.g. '2020-03-10T15:00:00Z'. A day before the end if omitted",
+			},
+			cli.StringFlag{
+				Name:  "to",
+				Usage: "End of the time range in RFC3339, e.g. '2020-03-11T15:00:00Z'. Now if omitted",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			fname := c.String("env")
+			if fname == "" {
+				return errors.New("you must specify an environment file")
+			}
+			var err error
+			till := time.Now()
+			if c.String("to") != "" {
+				if till, err = common.ParseTime(c.String("to"), time.UTC); err != nil {
+					return fmt.Errorf("parsing flag to: %v", err)
+				}
+			}
+			from := till.Add(-24 * time.Hour)
+			if c.String("from") != "" {
+				if from, err = common.ParseTime(c.String("from"), time.UTC); err != nil {
+					return fmt.Errorf("parsing flag from: %v", err)
+				}
+			}
+
+			conf := config.Load(fname)
+			kind := string(entity.KindExchratesService)
+			svc := service.New(conf, kind, sys.NewRepository(conf, kind), nil, sys.Precisions(conf), sys.QualityConfig(conf))
+			report, err := svc.GetQuality(context.Background(), common.SplitList([]string{c.String("currency")}), from, till)
 			if err != nil {
 				return err
 			}
-			return repo.MigrateUp()
+			out, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Printf("%s\n", out)
+			return nil
 		},
 	}
 }
 
+func exportCmd(flags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "export",
+		Usage: "Exports raw or aggregated exchange rates for a time range as csv, ndjson or parquet",
+		Flags: append(flags,
+			cli.StringFlag{
+				Name:  "currency, c",
+				Usage: "Comma-separated list of currencies to export",
+			},
+			cli.StringFlag{
+				Name:  "from",
+				Usage: "Start of the time range in RFC3339, e.g. '2020-03-10T15:00:00Z'",
+			},
+			cli.StringFlag{
+				Name:  "to",
+				Usage: "End of the time range in RFC3339, e.g. '2020-03-11T15:00:00Z'",
+			},
+			cli.StringFlag{
+				Name:  "tz",
+				Usage: "Time zone the times are presented and the intervals are aligned in, e.g. 'Europe/Moscow'. UTC if omitted",
+			},
+			cli.StringFlag{
+				Name:  "aggr",
+				Usage: "Aggregation interval (1min, 5min, 1hour, 1day). Raw rates are exported if omitted",
+			},
+			cli.StringFlag{
+				Name:  "format, f",
+				Value: export.FormatCSV,
+				Usage: "Output format (csv, ndjson, parquet)",
+			},
+			cli.StringFlag{
+				Name:  "out, o",
+				Usage: "Output file. Standard output is used if omitted",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			fname := c.String("env")
+			if fname == "" {
+				return errors.New("you must specify an environment file")
+			}
+			loc, err := common.ParseLocation(c.String("tz"))
+			if err != nil {
+				return fmt.Errorf("parsing flag tz: %v", err)
+			}
+			from, err := common.ParseTime(c.String("from"), loc)
+			if err != nil {
+				return fmt.Errorf("parsing flag from: %v", err)
+			}
+			till, err := common.ParseTime(c.String("to"), loc)
+			if err != nil {
+				return fmt.Errorf("parsing flag to: %v", err)
+			}
+			opts := service.ExportOpts{
+				Currencies: common.SplitList([]string{c.String("currency")}),
+				From:       from,
+				Till:       till,
+				AggrType:   c.String("aggr"),
+				Format:     c.String("format"),
+				Location:   loc,
+			}
+			if err := opts.Validate(); err != nil {
+				return err
+			}
+
+			conf := config.Load(fname)
+			kind := string(entity.KindExchratesService)
+			svc := service.New(conf, kind, sys.NewRepository(conf, kind), nil, sys.Precisions(conf), sys.QualityConfig(conf))
+
+			out := os.Stdout
+			if path := c.String("out"); path != "" {
+				f, err := os.Create(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			w := bufio.NewWriter(out)
+			if err := svc.Export(context.Background(), opts, w); err != nil {
+				return err
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func importCmd(flags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:      "import",
+		Usage:     "Imports exchange rates from csv or ndjson files with columns time, base, quote, rate, source",
+		ArgsUsage: "FILE...",
+		Flags: append(flags,
+			cli.StringFlag{
+				Name:  "format, f",
+				Usage: "Input format (csv, ndjson). Guessed by the file extension if omitted",
+			},
+			cli.StringFlag{
+				Name:  "conflict",
+				Value: entity.ConflictSkip,
+				Usage: "What to do with the rates that already exist (skip, overwrite, error)",
+			},
+		),
+		Action: func(c *cli.Context) error {
+			fname := c.String("env")
+			if fname == "" {
+				return errors.New("you must specify an environment file")
+			}
+			if c.NArg() == 0 {
+				return errors.New("you must specify at least one file to import")
+			}
+
+			conf := config.Load(fname)
+			kind := string(entity.KindExchratesService)
+			svc := service.New(conf, kind, sys.NewRepository(conf, kind), nil, sys.Precisions(conf), sys.QualityConfig(conf))
+
+			for _, path := range c.Args() {
+				format := c.String("format")
+				if format == "" {
+					format = importer.FormatOf(path)
+				}
+				report, err := importFile(svc, path, format, c.String("conflict"))
+				if report != nil {
+					out, _ := json.MarshalIndent(report, "", "  ")
+					fmt.Printf("%s:\n%s\n", path, out)
+				}
+				if err != nil {
+					return fmt.Errorf("importing %s: %v", path, err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func importFile(svc service.Service, path, format, conflictMode string) (*entity.ImportReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return svc.Import(context.Background(), format, conflictMode, bufio.NewReader(f))
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "Exchange Rates Service"
@@ -82,9 +561,18 @@ func main() {
 	app.Commands = []cli.Command{
 		startCmd(basicFlags),
 		migrateCmd(basicFlags),
+		seedCmd(basicFlags),
+		compactCmd(basicFlags),
+		fixCmd(basicFlags),
+		qualityCmd(basicFlags),
+		keysCmd(basicFlags),
+		usageCmd(basicFlags),
+		exportCmd(basicFlags),
+		importCmd(basicFlags),
 	}
 	err := app.Run(os.Args)
 	if err != nil {
-		log.Fatalf("error running the application: %s\n", err)
+		common.LogFatalf("error running the application: %s", err)
+		os.Exit(1)
 	}
 }
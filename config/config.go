@@ -29,13 +29,73 @@ type Config struct {
 	LogMaxAge   int    `env:"LOG_MAX_AGE"`
 	LogCompress bool   `env:"LOG_COMPRESS"`
 
+	LogLevel         string `env:"LOG_LEVEL" envDefault:"info"`
+	LogSinks         string `env:"LOG_SINKS" envDefault:"file"`
+	LogSyslogNetwork string `env:"LOG_SYSLOG_NETWORK"`
+	LogSyslogAddr    string `env:"LOG_SYSLOG_ADDR"`
+
 	RepositoryDriver string `env:"CUSTOMER_REPOSITORY_DRIVER"`
-	RepositoryDSN    string `env:"CUSTOMER_REPOSITORY_DSN"`
+	RepositoryDSN    string `env:"CUSTOMER_REPOSITORY_DSN" secret:"true"`
 
 	PollerInterval       time.Duration `env:"POLLER_INTERVAL"`
 	PollerBaseCurrencies []string      `env:"POLLER_BASE_CURRENCIES"`
 	PollerURL            string        `env:"POLLER_URL"`
 	PollerTimeout        time.Duration `env:"POLLER_TIMEOUT"`
+	PollerSource         string        `env:"POLLER_SOURCE" envDefault:"exchangeratesapi.io"`
+	PollerBatchSize      int           `env:"POLLER_BATCH_SIZE" envDefault:"100"`
+	PollerFlushInterval  time.Duration `env:"POLLER_FLUSH_INTERVAL" envDefault:"10s"`
+
+	RetentionRaw       time.Duration `env:"RETENTION_RAW" envDefault:"168h"`
+	Retention1Min      time.Duration `env:"RETENTION_1MIN" envDefault:"2160h"`
+	Retention1Hour     time.Duration `env:"RETENTION_1HOUR" envDefault:"0"`
+	CompactionInterval time.Duration `env:"COMPACTION_INTERVAL" envDefault:"1m"`
+	CompactionTimeout  time.Duration `env:"COMPACTION_TIMEOUT" envDefault:"5m"`
+
+	RateScale      int      `env:"RATE_SCALE" envDefault:"4"`
+	RateRounding   string   `env:"RATE_ROUNDING" envDefault:"half_even"`
+	RatePrecisions []string `env:"RATE_PRECISIONS"`
+
+	Fixings        []string      `env:"FIXINGS" envSeparator:";"`
+	FixingInterval time.Duration `env:"FIXING_INTERVAL" envDefault:"1m"`
+	FixingDelay    time.Duration `env:"FIXING_DELAY" envDefault:"1m"`
+	FixingTimeout  time.Duration `env:"FIXING_TIMEOUT" envDefault:"1m"`
+
+	QualityMaxJump    float64       `env:"QUALITY_MAX_JUMP" envDefault:"0.05"`
+	QualityStaleCount int           `env:"QUALITY_STALE_COUNT" envDefault:"30"`
+	QualityInterval   time.Duration `env:"QUALITY_INTERVAL" envDefault:"1h"`
+	QualityTimeout    time.Duration `env:"QUALITY_TIMEOUT" envDefault:"1m"`
+
+	AnomalyThreshold    float64 `env:"ANOMALY_THRESHOLD" envDefault:"6"`
+	AnomalyAlpha        float64 `env:"ANOMALY_ALPHA" envDefault:"0.05"`
+	AnomalyWarmup       int     `env:"ANOMALY_WARMUP" envDefault:"30"`
+	AnomalyMinDeviation float64 `env:"ANOMALY_MIN_DEVIATION" envDefault:"0.001"`
+	AnomalyPatience     int     `env:"ANOMALY_PATIENCE" envDefault:"5"`
+
+	AuthEnabled   bool   `env:"AUTH_ENABLED" envDefault:"true"`
+	AuthJWTSecret string `env:"AUTH_JWT_SECRET" secret:"true"`
+
+	RateLimitRate       float64       `env:"RATE_LIMIT_RATE" envDefault:"10"`
+	RateLimitBurst      int           `env:"RATE_LIMIT_BURST" envDefault:"100"`
+	RateLimitTrustProxy bool          `env:"RATE_LIMIT_TRUST_PROXY" envDefault:"false"`
+	QuotaDaily          int64         `env:"QUOTA_DAILY" envDefault:"0"`
+	UsageFlushInterval  time.Duration `env:"USAGE_FLUSH_INTERVAL" envDefault:"1m"`
+	UsageFlushTimeout   time.Duration `env:"USAGE_FLUSH_TIMEOUT" envDefault:"10s"`
+
+	CacheMaxEntries int `env:"CACHE_MAX_ENTRIES" envDefault:"1000"`
+
+	HealthTimeout time.Duration `env:"HEALTH_TIMEOUT" envDefault:"2s"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`
+
+	LeaderElection bool          `env:"LEADER_ELECTION" envDefault:"false"`
+	LeaderLockKey  int64         `env:"LEADER_LOCK_KEY" envDefault:"7301"`
+	LeaderInterval time.Duration `env:"LEADER_INTERVAL" envDefault:"5s"`
+	LeaderTimeout  time.Duration `env:"LEADER_TIMEOUT" envDefault:"2s"`
+
+	OtelEndpoint    string  `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OtelInsecure    bool    `env:"OTEL_INSECURE" envDefault:"true"`
+	OtelSampleRatio float64 `env:"OTEL_SAMPLE_RATIO" envDefault:"1"`
+	OtelServiceName string  `env:"OTEL_SERVICE_NAME" envDefault:"exchrates"`
 }
 
 func Load(filenames ...string) Config {
@@ -58,6 +118,7 @@ func Load(filenames ...string) Config {
 	return cfg
 }
 
+// Print prints the configuration, masking the fields tagged secret, like the DSN and the JWT secret.
 func (c Config) Print(fname string) {
 	fmt.Println("-------------------------------------------------")
 	fmt.Printf("loading environment configuration from %s\n", fname)
@@ -67,8 +128,12 @@ func (c Config) Print(fname string) {
 	typeOfT := s.Type()
 
 	for i := 0; i < s.NumField(); i++ {
-		f := s.Field(i)
-		fmt.Printf("%s=%v\n", typeOfT.Field(i).Name, f.Interface())
+		f, field := s.Field(i), typeOfT.Field(i)
+		if field.Tag.Get("secret") == "true" && !f.IsZero() {
+			fmt.Printf("%s=****\n", field.Name)
+			continue
+		}
+		fmt.Printf("%s=%v\n", field.Name, f.Interface())
 	}
 
 	fmt.Println("-------------------------------------------------")